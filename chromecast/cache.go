@@ -0,0 +1,114 @@
+package chromecast
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// deviceCache is the JSON form of a saved cache.
+type deviceCache struct {
+	Devices []cachedDevice `json:"devices"`
+}
+
+type cachedDevice struct {
+	Device   KnownDevice `json:"device"`
+	LastSeen time.Time   `json:"lastSeen"`
+}
+
+// SaveCache writes the known devices, and when each was last seen, to the file at
+// path as JSON. Devices that have outlived their lifetime are left out. The file is
+// replaced whole, so a reader never sees it half written.
+func (d *Discoverer) SaveCache(path string) error {
+	var c deviceCache
+	d.mu.RLock()
+	n := time.Now()
+	for _, k := range d.devs {
+		if t, life := d.lifetime(k); n.Sub(t) >= life {
+			continue
+		}
+		k.mu.RLock()
+		c.Devices = append(c.Devices, cachedDevice{Device: k.KnownDevice, LastSeen: k.lastSeen})
+		k.mu.RUnlock()
+	}
+	d.mu.RUnlock()
+	b, err := json.MarshalIndent(c, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// LoadCache adds the devices saved by SaveCache in the file at path to those known,
+// so that they can be used at once. They are marked Stale, and subscribers are told
+// of them, until live discovery confirms them; any not heard from in the first full
+// round of queries after loading are removed. Devices already known are left alone.
+// A missing file is not an error.
+func (d *Discoverer) LoadCache(path string) error {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var c deviceCache
+	err = json.Unmarshal(b, &c)
+	if err != nil {
+		return err
+	}
+
+	var added []*DiscoveryUpdate
+	d.mu.Lock()
+	for _, cd := range c.Devices {
+		if _, ok := d.devs[cd.Device.ID]; ok {
+			continue
+		}
+		cd.Device.Stale = true
+		d.devs[cd.Device.ID] = &knownDevice{KnownDevice: cd.Device, lastSeen: cd.LastSeen, loadRound: d.round}
+		after := cd.Device
+		added = append(added, &DiscoveryUpdate{ID: after.ID, Active: true, Kind: DeviceAdded, After: &after})
+	}
+	d.mu.Unlock()
+	for _, u := range added {
+		d.send(u)
+	}
+	return nil
+}
+
+// SetCacheFile loads the devices saved in the file at path, as LoadCache does, and
+// has the known devices saved there again when the Discoverer stops.
+func (d *Discoverer) SetCacheFile(path string) error {
+	d.mu.Lock()
+	d.cacheFile = path
+	d.mu.Unlock()
+	return d.LoadCache(path)
+}
+
+// saveCacheFile saves the known devices to the file given to SetCacheFile, if any.
+func (d *Discoverer) saveCacheFile() {
+	d.mu.RLock()
+	path := d.cacheFile
+	d.mu.RUnlock()
+	if path != "" {
+		d.SaveCache(path)
+	}
+}
@@ -0,0 +1,110 @@
+package chromecast_test
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ironiridis/klonderoo/chromecast"
+	"github.com/ironiridis/klonderoo/mdns"
+)
+
+func TestDiscovererCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "devices.json")
+	vn := &mdns.VirtualNetwork{}
+	castDevice(t, vn, "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", "Stays", net.IPv4(10, 0, 0, 71))
+	leaving, _ := castDevice(t, vn, "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", "Leaves", net.IPv4(10, 0, 0, 72))
+
+	d, err := chromecast.DiscoverTransport(vn, nil)
+	if err != nil {
+		t.Fatalf("DiscoverTransport returned %+v", err)
+	}
+	if err := d.SetCacheFile(path); err != nil {
+		t.Fatalf("SetCacheFile of a missing file returned %+v", err)
+	}
+	for len(d.List()) < 2 {
+		select {
+		case <-d.Chan:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("only %d devices were discovered", len(d.List()))
+		}
+	}
+	d.Close()
+	leaving.Close()
+
+	d, err = chromecast.DiscoverTransport(vn, nil)
+	if err != nil {
+		t.Fatalf("DiscoverTransport returned %+v", err)
+	}
+	defer d.Close()
+	d.SetQueryInterval(300 * time.Millisecond)
+	if err := d.LoadCache(path); err != nil {
+		t.Fatalf("LoadCache returned %+v", err)
+	}
+	if l := d.List(); len(l) != 2 || !l[0].Stale || !l[1].Stale {
+		t.Fatalf("after LoadCache the devices were %+v", l)
+	}
+
+	kinds := map[string]chromecast.UpdateKind{}
+	deadline := time.After(10 * time.Second)
+	for kinds["Stays"] != chromecast.DeviceUpdated || kinds["Leaves"] != chromecast.DeviceRemoved {
+		select {
+		case u := <-d.Chan:
+			switch u.Kind {
+			case chromecast.DeviceAdded:
+				if !u.After.Stale {
+					t.Errorf("a device was added as %+v before being loaded", u.After)
+				}
+				kinds[u.After.FriendlyName] = u.Kind
+			case chromecast.DeviceUpdated:
+				if !u.Changed.Has(chromecast.FieldStale) || u.After.Stale {
+					t.Errorf("a device was updated to %+v (changed %v)", u.After, u.Changed)
+				}
+				kinds[u.After.FriendlyName] = u.Kind
+			case chromecast.DeviceRemoved:
+				kinds[u.Before.FriendlyName] = u.Kind
+			}
+		case <-deadline:
+			t.Fatalf("the cached devices were never confirmed or expired: %v", kinds)
+		}
+	}
+}
+
+func TestDiscovererCacheExpired(t *testing.T) {
+	dir := t.TempDir()
+	in, out := filepath.Join(dir, "in.json"), filepath.Join(dir, "out.json")
+	c := fmt.Sprintf(`{"devices": [
+		{"device": {"ID": "aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa", "FriendlyName": "Recent"}, "lastSeen": %q},
+		{"device": {"ID": "bbbbbbbb-bbbb-bbbb-bbbb-bbbbbbbbbbbb", "FriendlyName": "Old"}, "lastSeen": %q}
+	]}`, time.Now().Format(time.RFC3339Nano), time.Now().Add(-time.Hour).Format(time.RFC3339Nano))
+	if err := os.WriteFile(in, []byte(c), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := chromecast.DiscoverTransport(&mdns.VirtualNetwork{}, nil)
+	if err != nil {
+		t.Fatalf("DiscoverTransport returned %+v", err)
+	}
+	defer d.Close()
+	if err := d.LoadCache(in); err != nil {
+		t.Fatalf("LoadCache returned %+v", err)
+	}
+	if err := d.SaveCache(out); err != nil {
+		t.Fatalf("SaveCache returned %+v", err)
+	}
+
+	d, err = chromecast.DiscoverTransport(&mdns.VirtualNetwork{}, nil)
+	if err != nil {
+		t.Fatalf("DiscoverTransport returned %+v", err)
+	}
+	defer d.Close()
+	if err := d.LoadCache(out); err != nil {
+		t.Fatalf("LoadCache returned %+v", err)
+	}
+	if l := d.List(); len(l) != 1 || l[0].FriendlyName != "Recent" {
+		t.Errorf("after saving and loading again the devices were %+v", l)
+	}
+}
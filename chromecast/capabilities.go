@@ -0,0 +1,135 @@
+package chromecast
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Capabilities is the bitmask a Cast device advertises in the "ca" field of
+// its TXT record.
+type Capabilities uint64
+
+// Capability bits, as the Cast sender libraries define them. Devices set
+// others besides, which are kept but not named here.
+const (
+	CapabilityVideoOut       Capabilities = 1 << 0
+	CapabilityVideoIn        Capabilities = 1 << 1
+	CapabilityAudioOut       Capabilities = 1 << 2
+	CapabilityAudioIn        Capabilities = 1 << 3
+	CapabilityDevMode        Capabilities = 1 << 4
+	CapabilityMultizoneGroup Capabilities = 1 << 5
+)
+
+// SupportsVideo reports whether the device can play video.
+func (c Capabilities) SupportsVideo() bool {
+	return c&CapabilityVideoOut != 0
+}
+
+// SupportsAudio reports whether the device can play audio.
+func (c Capabilities) SupportsAudio() bool {
+	return c&CapabilityAudioOut != 0
+}
+
+// IsGroup reports whether the device is a multizone group of speakers rather
+// than a single device.
+func (c Capabilities) IsGroup() bool {
+	return c&CapabilityMultizoneGroup != 0
+}
+
+func (c Capabilities) String() string {
+	var names []string
+	for _, b := range []struct {
+		bit  Capabilities
+		name string
+	}{
+		{CapabilityVideoOut, "video-out"},
+		{CapabilityVideoIn, "video-in"},
+		{CapabilityAudioOut, "audio-out"},
+		{CapabilityAudioIn, "audio-in"},
+		{CapabilityDevMode, "dev-mode"},
+		{CapabilityMultizoneGroup, "group"},
+	} {
+		if c&b.bit != 0 {
+			names = append(names, b.name)
+			c &^= b.bit
+		}
+	}
+	if c != 0 || len(names) == 0 {
+		names = append(names, "0x"+strconv.FormatUint(uint64(c), 16))
+	}
+	return strings.Join(names, "|")
+}
+
+// parseCapabilities reads the decimal "ca" field. A missing or malformed
+// field yields no capabilities.
+func parseCapabilities(s string) Capabilities {
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return Capabilities(n)
+}
+
+// Flags is a bit field a Cast device advertises in hexadecimal, as it does
+// the "bs" and "ebs" fields of its TXT record. Their bits are undocumented,
+// so none are named, but a change to them can still be noticed.
+type Flags uint64
+
+func (f Flags) String() string {
+	return strings.ToUpper(strconv.FormatUint(uint64(f), 16))
+}
+
+// MarshalText renders the flags in hexadecimal, as the device does.
+func (f Flags) MarshalText() ([]byte, error) {
+	return []byte(f.String()), nil
+}
+
+// UnmarshalText parses flags in hexadecimal.
+func (f *Flags) UnmarshalText(b []byte) error {
+	n, err := strconv.ParseUint(string(b), 16, 64)
+	if err != nil {
+		return fmt.Errorf("invalid flags %q", b)
+	}
+	*f = Flags(n)
+	return nil
+}
+
+// parseFlags reads a hexadecimal field such as "bs". A missing or malformed
+// field yields no flags.
+func parseFlags(s string) Flags {
+	var f Flags
+	if f.UnmarshalText([]byte(s)) != nil {
+		return 0
+	}
+	return f
+}
+
+// State is what a Cast device advertises in the "st" field of its TXT record:
+// whether a sender has a session running on it.
+type State int
+
+const (
+	StateIdle    State = 0 // nothing is being cast
+	StateCasting State = 1 // an app is running, as named by KnownDevice.Status
+)
+
+func (s State) String() string {
+	switch s {
+	case StateIdle:
+		return "idle"
+	case StateCasting:
+		return "casting"
+	}
+	return "state " + strconv.Itoa(int(s))
+}
+
+// parseState reads the decimal "st" field. A missing or malformed field is
+// taken as idle.
+func parseState(s string) State {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return StateIdle
+	}
+	return State(n)
+}
@@ -0,0 +1,61 @@
+package chromecast
+
+import (
+	"encoding/hex"
+	"fmt"
+)
+
+// DeviceID is the UUID a Chromecast identifies itself by.
+type DeviceID [16]byte
+
+// ParseDeviceID reads a DeviceID given as 32 hex digits, as Cast TXT records
+// give it, or in the UUID form String writes. Either case is accepted.
+func ParseDeviceID(s string) (DeviceID, error) {
+	var id DeviceID
+	h := s
+	if len(s) == 36 {
+		if s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+			return id, fmt.Errorf("invalid device id %q", s)
+		}
+		h = s[:8] + s[9:13] + s[14:18] + s[19:23] + s[24:]
+	}
+	if len(h) != 2*len(id) {
+		return id, fmt.Errorf("invalid device id %q", s)
+	}
+	if _, err := hex.Decode(id[:], []byte(h)); err != nil {
+		return id, fmt.Errorf("invalid device id %q", s)
+	}
+	return id, nil
+}
+
+// String renders the ID in its canonical UUID form, such as
+// "0badcafe-0000-1111-2222-333344445555".
+func (id DeviceID) String() string {
+	var b [36]byte
+	hex.Encode(b[0:8], id[0:4])
+	b[8] = '-'
+	hex.Encode(b[9:13], id[4:6])
+	b[13] = '-'
+	hex.Encode(b[14:18], id[6:8])
+	b[18] = '-'
+	hex.Encode(b[19:23], id[8:10])
+	b[23] = '-'
+	hex.Encode(b[24:], id[10:])
+	return string(b[:])
+}
+
+// MarshalText renders the ID as String does, which is also how it appears in
+// JSON.
+func (id DeviceID) MarshalText() ([]byte, error) {
+	return []byte(id.String()), nil
+}
+
+// UnmarshalText parses the ID as ParseDeviceID does.
+func (id *DeviceID) UnmarshalText(b []byte) error {
+	v, err := ParseDeviceID(string(b))
+	if err != nil {
+		return err
+	}
+	*id = v
+	return nil
+}
@@ -0,0 +1,38 @@
+package chromecast_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/ironiridis/klonderoo/chromecast"
+)
+
+func TestDeviceID(t *testing.T) {
+	want := chromecast.DeviceID{0x0b, 0xad, 0xca, 0xfe, 0, 0, 0x11, 0x11, 0x22, 0x22, 0x33, 0x33, 0x44, 0x44, 0x55, 0x55}
+	for _, s := range []string{"0badcafe000011112222333344445555", "0BADCAFE-0000-1111-2222-333344445555"} {
+		id, err := chromecast.ParseDeviceID(s)
+		if err != nil || id != want {
+			t.Errorf("ParseDeviceID(%q) returned %v, %v", s, id, err)
+		}
+	}
+	for _, s := range []string{"", "0badcafe", "0badcafe00001111222233334444555g", "0badcafe+0000-1111-2222-333344445555", "0badcafe-00001-111-2222-333344445555"} {
+		if _, err := chromecast.ParseDeviceID(s); err == nil {
+			t.Errorf("ParseDeviceID(%q) succeeded", s)
+		}
+	}
+
+	if s := want.String(); s != "0badcafe-0000-1111-2222-333344445555" {
+		t.Errorf("DeviceID.String returned %q", s)
+	}
+	b, err := json.Marshal(map[chromecast.DeviceID]chromecast.DeviceID{want: want})
+	if err != nil {
+		t.Fatalf("json.Marshal returned %+v", err)
+	}
+	if string(b) != `{"0badcafe-0000-1111-2222-333344445555":"0badcafe-0000-1111-2222-333344445555"}` {
+		t.Errorf("json.Marshal gave %s", b)
+	}
+	var m map[chromecast.DeviceID]chromecast.DeviceID
+	if err := json.Unmarshal(b, &m); err != nil || m[want] != want {
+		t.Errorf("json.Unmarshal gave %v, %v", m, err)
+	}
+}
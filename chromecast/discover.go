@@ -1,28 +1,53 @@
 package chromecast
 
 import (
+	"context"
 	"fmt"
 	"net"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/ironiridis/klonderoo/mdns"
 )
 
-// A Discoverer provides a channel which clients should range on for updates.
+// castService is the DNS-SD service type Chromecasts advertise.
+const castService = "_googlecast._tcp.local."
+
+// resolveTimeout bounds each follow-up query made for records a device left
+// out of its response.
+const resolveTimeout = 2 * time.Second
+
+// A Discoverer finds Chromecasts on the network, and tells its subscribers as they
+// come, change and go.
 type Discoverer struct {
-	mu            sync.RWMutex
-	Chan          chan *DiscoveryUpdate
-	stop          chan bool
+	mu sync.RWMutex
+
+	// Chan is a subscription made by Discover, with room for a few updates. It
+	// behaves as one returned by Subscribe.
+	//
+	// Deprecated: Use Subscribe, which lets each reader have its own channel.
+	Chan chan *DiscoveryUpdate
+
+	subMu         sync.Mutex
+	subs          map[<-chan *DiscoveryUpdate]chan *DiscoveryUpdate
+	ctx           context.Context
+	stop          context.CancelFunc
+	wg            sync.WaitGroup
+	resolving     sync.WaitGroup             // counts the goroutines resolving devices, or waiting on them
+	pending       map[string]*pendingResolve // by lowered instance name; see process
 	devs          knownDevices
 	queryinterval time.Duration
 	expireRate    int
 	ifc           *net.Interface
+	tr            mdns.Transport
+	round         int             // counts rounds of queries
+	cacheFile     string          // see SetCacheFile
+	static        map[string]bool // the host:port of each Registered device
+	wake          chan struct{}   // prods the querier to reschedule
+	changed       bool            // whether an update was sent since the last query
 }
 
-// DeviceID is an opaque container for a Chromecast UUID.
-type DeviceID [16]byte
-
 // KnownDevice describes a Chromecast that has been discovered and seen recently.
 type KnownDevice struct {
 	ID           DeviceID
@@ -31,10 +56,27 @@ type KnownDevice struct {
 	IPv4         string
 	IPv6         string
 	Model        string
+	Port         uint16
+
+	// The rest are read from the device's TXT record as well.
+	Capabilities Capabilities // "ca"
+	Status       string       // "rs": what the device is doing, such as "Spotify"; empty when idle
+	State        State        // "st": whether anything is being cast
+	Version      string       // "ve": the Cast protocol version
+	Icon         string       // "ic": the path of the device's icon on its HTTP server
+	BS           Flags        // "bs"
+	EBS          Flags        // "ebs"
+
+	// Stale is set for a device loaded by LoadCache that live discovery has not
+	// confirmed yet.
+	Stale bool
 }
 type knownDevice struct {
-	mu       sync.RWMutex
-	lastSeen time.Time
+	mu        sync.RWMutex
+	lastSeen  time.Time
+	loadRound int           // for a Stale device, the query round it was loaded in
+	inst      string        // the service instance name, if mDNS last described the device
+	ttl       time.Duration // how long the device lasts unheard; zero means the expire rate applies
 	KnownDevice
 }
 type knownDevices map[DeviceID]*knownDevice
@@ -46,25 +88,29 @@ func (k *knownDevice) export() *KnownDevice {
 	return &c
 }
 
-func (k *knownDevice) touch() {
+// touch marks the device as heard from, for ttl longer if that is not zero.
+func (k *knownDevice) touch(ttl time.Duration) {
 	k.mu.Lock()
 	k.lastSeen = time.Now()
+	if ttl > 0 {
+		k.ttl = ttl
+	}
 	k.mu.Unlock()
 }
 
-// DiscoveryUpdate informs a goroutine reading a Discover channel when a Chromecast
-// is newly discovered, or when a known Chromecast becomes unreachable. The receiving
-// goroutine should assume that the Chromecast identified by ID has changed state in
-// some way; coming, going, or updating.
-type DiscoveryUpdate struct {
-	ID     DeviceID
-	Active bool
+// Stop will cause the Discoverer to terminate its network activity. Subscribers'
+// channels are closed once any query in progress has been abandoned; Close waits
+// for that.
+func (d *Discoverer) Stop() {
+	d.stop()
 }
 
-// Stop will cause the Discoverer to terminate its network activity and close Chan.
-func (d *Discoverer) Stop() {
-	close(d.stop)
-	close(d.Chan)
+// Close stops the Discoverer, and returns once it has stopped and every subscriber's
+// channel has been closed.
+func (d *Discoverer) Close() error {
+	d.stop()
+	d.wg.Wait()
+	return nil
 }
 
 // Get retrieves a copy of a device by its ID.
@@ -73,93 +119,270 @@ func (d *Discoverer) Get(id DeviceID) (*KnownDevice, error) {
 	m, ok := d.devs[id]
 	d.mu.RUnlock()
 	if !ok {
-		return nil, fmt.Errorf("no known device id of %032x", id)
+		return nil, fmt.Errorf("no known device id of %v", id)
 	}
 	return m.export(), nil
 }
 
-func (d *Discoverer) mdnsQuery() {
-	c, err := mdns.NewClient("_googlecast._tcp.local.", mdns.RecordTypePTR)
+// mdnsQuery asks the network for Cast devices, and returns the resolutions of
+// those that answered, which go on in the background.
+func (d *Discoverer) mdnsQuery() []*pendingResolve {
+	c, err := mdns.NewClient(castService, mdns.RecordTypePTR)
 	if err != nil {
-		return
+		return nil
 	}
 	c.SetInterface(d.ifc)
-	ch, err := c.Run()
+	c.SetTransport(d.tr)
+	recs, err := c.Collect(d.ctx)
 	if err != nil {
-		return
-	}
-	for r := range ch {
-		fmt.Printf("lol %+v\n", r)
+		return nil
 	}
+	return d.process(recs)
 }
 
-func (d *Discoverer) found(n *KnownDevice) {
+// resolve builds the KnownDevice for the service instance named inst from
+// recs, along with how long it lasts unheard: the shortest TTL among its
+// records. What recs leave out is taken from the device as already known by
+// that name, or else asked of the network.
+func (d *Discoverer) resolve(inst string, recs []mdns.Record) (*KnownDevice, time.Duration, bool) {
+	var prev *KnownDevice
+	var prevTTL, ttl time.Duration
 	d.mu.RLock()
-	k, ok := d.devs[n.ID]
+	if k := d.byInstance(inst); k != nil {
+		prev = k.export()
+		k.mu.RLock()
+		prevTTL = k.ttl
+		k.mu.RUnlock()
+	}
 	d.mu.RUnlock()
-	if ok && *n == k.KnownDevice {
+	heard := func(t time.Duration) {
+		if ttl == 0 || t < ttl {
+			ttl = t
+		}
+	}
+	for i := range recs {
+		if ptr, ok := recs[i].Value.(*mdns.RecordPTR); ok && recs[i].TTL > 0 && strings.EqualFold(ptr.Name.String(), inst) {
+			heard(time.Duration(recs[i].TTL) * time.Second)
+		}
+	}
+
+	n := &KnownDevice{}
+	r := findRecord(recs, inst, mdns.RecordTypeSRV)
+	if r == nil && prev == nil {
+		recs = append(recs, d.ask(inst, mdns.RecordTypeSRV)...)
+		r = findRecord(recs, inst, mdns.RecordTypeSRV)
+	}
+	switch {
+	case r != nil:
+		heard(time.Duration(r.TTL) * time.Second)
+		srv := r.Value.(*mdns.RecordSRV)
+		n.Hostname, n.Port = srv.Target.String(), srv.Port
+	case prev != nil:
+		heard(prevTTL)
+		n.Hostname, n.Port = prev.Hostname, prev.Port
+	default:
+		return nil, 0, false
+	}
+
+	r = findRecord(recs, inst, mdns.RecordTypeTXT)
+	if r == nil && prev == nil {
+		recs = append(recs, d.ask(inst, mdns.RecordTypeTXT)...)
+		r = findRecord(recs, inst, mdns.RecordTypeTXT)
+	}
+	switch {
+	case r != nil:
+		heard(time.Duration(r.TTL) * time.Second)
+		fields := txtFields(r.Value.(*mdns.RecordTXT))
+		id, err := ParseDeviceID(fields["id"])
+		if err != nil {
+			return nil, 0, false
+		}
+		n.ID = id
+		n.FriendlyName = fields["fn"]
+		n.Model = fields["md"]
+		n.Capabilities = parseCapabilities(fields["ca"])
+		n.Status = fields["rs"]
+		n.State = parseState(fields["st"])
+		n.Version = fields["ve"]
+		n.Icon = fields["ic"]
+		n.BS = parseFlags(fields["bs"])
+		n.EBS = parseFlags(fields["ebs"])
+	case prev != nil:
+		heard(prevTTL)
+		n.ID = prev.ID
+		n.FriendlyName, n.Model, n.Capabilities = prev.FriendlyName, prev.Model, prev.Capabilities
+		n.Status, n.State, n.Version, n.Icon = prev.Status, prev.State, prev.Version, prev.Icon
+		n.BS, n.EBS = prev.BS, prev.EBS
+	default:
+		return nil, 0, false
+	}
+
+	n.IPv4, n.IPv6 = addrsFor(recs, n.Hostname)
+	if n.IPv4 == "" && n.IPv6 == "" {
+		if prev != nil && strings.EqualFold(prev.Hostname, n.Hostname) {
+			n.IPv4, n.IPv6 = prev.IPv4, prev.IPv6
+		} else {
+			recs = append(recs, d.ask(n.Hostname, mdns.RecordTypeA)...)
+			recs = append(recs, d.ask(n.Hostname, mdns.RecordTypeAAAA)...)
+			n.IPv4, n.IPv6 = addrsFor(recs, n.Hostname)
+		}
+	}
+	return n, ttl, true
+}
+
+// ask queries for records of type t for name, returning whatever is heard.
+func (d *Discoverer) ask(name string, t mdns.RecordType) []mdns.Record {
+	r := &mdns.Resolver{Interface: d.ifc, Transport: d.tr, Timeout: resolveTimeout}
+	recs, _ := r.Query(d.ctx, name, t)
+	return recs
+}
+
+// findRecord returns the first record in recs of type t for name, or nil.
+func findRecord(recs []mdns.Record, name string, t mdns.RecordType) *mdns.Record {
+	for i := range recs {
+		if recs[i].Type == t && recs[i].TTL > 0 && strings.EqualFold(recs[i].Subject.String(), name) {
+			return &recs[i]
+		}
+	}
+	return nil
+}
+
+// addrsFor returns the first IPv4 and IPv6 addresses in recs for host.
+func addrsFor(recs []mdns.Record, host string) (v4, v6 string) {
+	for i := range recs {
+		if recs[i].TTL == 0 || !strings.EqualFold(recs[i].Subject.String(), host) {
+			continue
+		}
+		switch a := recs[i].Value.(type) {
+		case *mdns.RecordA:
+			if v4 == "" {
+				v4 = a.Addr.String()
+			}
+		case *mdns.RecordAAAA:
+			if v6 == "" {
+				v6 = a.Addr.String()
+			}
+		}
+	}
+	return
+}
+
+// txtFields splits the "key=value" strings of a TXT record into a map. Keys
+// are case-insensitive (RFC 6763 sec 6.4), so they are lowered; the first
+// occurrence of a key wins.
+func txtFields(txt *mdns.RecordTXT) map[string]string {
+	m := map[string]string{}
+	for _, s := range txt.Strings() {
+		k, v, _ := strings.Cut(s, "=")
+		k = strings.ToLower(k)
+		if _, dup := m[k]; !dup && k != "" {
+			m[k] = v
+		}
+	}
+	return m
+}
+
+// found records that n was heard from, by mDNS as the service instance inst
+// with a lifetime of ttl, or by a probe if inst is empty.
+func (d *Discoverer) found(n *KnownDevice, inst string, ttl time.Duration) {
+	// the check and the change are made under one lock, since devices are
+	// resolved concurrently
+	d.mu.Lock()
+	k, ok := d.devs[n.ID]
+	same := ok && *n == k.KnownDevice
+	if same && k.inst == inst {
 		// this device is already known, and this update
 		// has only known values
-		k.touch()
+		d.mu.Unlock()
+		k.touch(ttl)
 		return
 	}
 
-	d.mu.Lock()
-	d.devs[n.ID] = &knownDevice{KnownDevice: *n, lastSeen: time.Now()}
+	d.devs[n.ID] = &knownDevice{KnownDevice: *n, lastSeen: time.Now(), inst: inst, ttl: ttl}
+	if !same {
+		d.changed = true
+	}
 	d.mu.Unlock()
+	if same {
+		return
+	}
 
-	d.Chan <- &DiscoveryUpdate{ID: n.ID, Active: true}
+	after := *n
+	u := &DiscoveryUpdate{ID: n.ID, Active: true, Kind: DeviceAdded, After: &after}
+	if ok {
+		u.Kind, u.Before = DeviceUpdated, k.export()
+		u.Changed = diffDevices(u.Before, u.After)
+	}
+	d.send(u)
 }
 
+// expireStale forgets the devices loaded from a cache before the query round
+// that has just finished, and not confirmed during it. A round cut short by Stop
+// confirms nothing, so expires nothing.
+func (d *Discoverer) expireStale(round int) {
+	if d.ctx.Err() != nil {
+		return
+	}
+	var gone []DeviceID
+	d.mu.RLock()
+	for id, k := range d.devs {
+		if k.Stale && k.loadRound < round {
+			gone = append(gone, id)
+		}
+	}
+	d.mu.RUnlock()
+	for _, id := range gone {
+		d.forget(id)
+	}
+}
+
+// expireCheck forgets the devices that have gone unheard for longer than they
+// last.
 func (d *Discoverer) expireCheck() {
+	var gone []DeviceID
 	d.mu.RLock()
 	n := time.Now()
 	for id, k := range d.devs {
-		k.mu.RLock()
-		t := k.lastSeen
-		k.mu.RUnlock()
-		if n.Sub(t) > time.Duration(d.expireRate)*d.queryinterval {
-			go d.forget(id)
+		if k.Stale {
+			// left to expireStale
+			continue
+		}
+		t, life := d.lifetime(k)
+		if n.Sub(t) >= life {
+			gone = append(gone, id)
 		}
 	}
 	d.mu.RUnlock()
+	for _, id := range gone {
+		d.forget(id)
+	}
 }
 
 func (d *Discoverer) forget(id DeviceID) {
 	d.mu.Lock()
+	k, ok := d.devs[id]
 	delete(d.devs, id)
+	d.changed = d.changed || ok
 	d.mu.Unlock()
-	d.Chan <- &DiscoveryUpdate{ID: id, Active: false}
-}
-
-func (d *Discoverer) querier() {
-	t := time.NewTimer(d.queryinterval)
-	defer t.Stop()
-
-	// run one mdns query immediately
-	d.mdnsQuery()
-
-	for {
-		select {
-		case <-d.stop:
-			return
-		case <-t.C:
-			d.mdnsQuery()
-			go d.expireCheck()
-			t.Reset(d.queryinterval)
-		}
+	if !ok {
+		return
 	}
+	d.send(&DiscoveryUpdate{ID: id, Kind: DeviceRemoved, Before: k.export()})
 }
 
-// SetQueryInterval changes the length of time between network queries for devices.
+// SetQueryInterval changes the length of time between network queries for devices,
+// which is 20 seconds by default. While no device comes, changes or goes, the time
+// is doubled after each query, up to 16 times the interval.
 func (d *Discoverer) SetQueryInterval(i time.Duration) {
 	d.mu.Lock()
 	d.queryinterval = i
 	d.mu.Unlock()
+	d.reschedule()
 }
 
-// SetExpireRate defines the length of time until a device is considered "gone" as a
-// multiple of the query interval. This must be at least 1, and defaults to 3.
+// SetExpireRate defines the length of time until a device registered by address is
+// considered "gone" as a multiple of the query interval. This must be at least 1, and
+// defaults to 3. Devices discovered by mDNS last as long as their records' TTLs say.
 func (d *Discoverer) SetExpireRate(m int) error {
 	if m < 1 {
 		return fmt.Errorf("expire rate of %d missed queries is invalid", m)
@@ -167,20 +390,40 @@ func (d *Discoverer) SetExpireRate(m int) error {
 	d.mu.Lock()
 	d.expireRate = m
 	d.mu.Unlock()
+	d.reschedule()
 	return nil
 }
 
 // Discover creates a Discoverer and begins listening on the interface specified by ifc
 // (or some OS-dependent one, if nil).
 func Discover(ifc *net.Interface) (*Discoverer, error) {
+	return DiscoverContext(context.Background(), nil, ifc)
+}
+
+// DiscoverTransport is like Discover, but sends its queries through t instead of
+// the host's network. A nil t means mdns.UDPTransport.
+func DiscoverTransport(t mdns.Transport, ifc *net.Interface) (*Discoverer, error) {
+	return DiscoverContext(context.Background(), t, ifc)
+}
+
+// DiscoverContext is like DiscoverTransport, but the Discoverer also stops when ctx
+// is done.
+func DiscoverContext(ctx context.Context, t mdns.Transport, ifc *net.Interface) (*Discoverer, error) {
 	d := &Discoverer{
-		Chan:          make(chan *DiscoveryUpdate),
-		stop:          make(chan bool),
+		tr:            t,
+		subs:          map[<-chan *DiscoveryUpdate]chan *DiscoveryUpdate{},
 		ifc:           ifc,
 		devs:          knownDevices{},
+		static:        map[string]bool{},
+		pending:       map[string]*pendingResolve{},
+		wake:          make(chan struct{}, 1),
 		queryinterval: 20 * time.Second,
 		expireRate:    3,
 	}
+	d.Chan = make(chan *DiscoveryUpdate, chanBuffer)
+	d.subs[d.Chan] = d.Chan
+	d.ctx, d.stop = context.WithCancel(ctx)
+	d.wg.Add(1)
 	go d.querier()
 
 	return d, nil
@@ -0,0 +1,329 @@
+package chromecast_test
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ironiridis/klonderoo/chromecast"
+	"github.com/ironiridis/klonderoo/mdns"
+)
+
+func TestDiscovererQueries(t *testing.T) {
+	vn := &mdns.VirtualNetwork{}
+	link, err := vn.Listen(nil, mdns.DefaultSocketOptions())
+	if err != nil {
+		t.Fatalf("VirtualNetwork.Listen returned %+v", err)
+	}
+	defer link.Close()
+
+	d, err := chromecast.DiscoverTransport(vn, nil)
+	if err != nil {
+		t.Fatalf("DiscoverTransport returned %+v", err)
+	}
+	defer d.Stop()
+
+	link.SetDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, mdns.MaximumPacketSize)
+	n, _, _, err := link.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("no query was heard: %+v", err)
+	}
+	m := &mdns.Message{}
+	if err := m.Decode(buf[:n], 10); err != nil {
+		t.Fatalf("the query did not decode: %+v", err)
+	}
+	if len(m.Questions) != 1 {
+		t.Fatalf("the query asked %d questions", len(m.Questions))
+	}
+	q := m.Questions[0]
+	if q.Type != mdns.RecordTypePTR || q.Subject.String() != "_googlecast._tcp.local." {
+		t.Errorf("the query asked for %v %q", q.Type, q.Subject.String())
+	}
+}
+
+// castText builds the TXT record of a Chromecast playing status, or idle if
+// status is empty.
+func castText(id, name, status string) []string {
+	st := "st=0"
+	if status != "" {
+		st = "st=1"
+	}
+	return []string{"id=" + id, "md=Chromecast", "fn=" + name, "ve=05", "ca=4101", "ic=/setup/icon.png", "rs=" + status, st, "bs=FA8FCA000000"}
+}
+
+// castDevice starts a Responder on vn advertising a Chromecast as one would.
+func castDevice(t *testing.T, vn *mdns.VirtualNetwork, id, name string, ip net.IP) (*mdns.Responder, *mdns.Service) {
+	rs, err := mdns.NewResponderTransport(vn, nil)
+	if err != nil {
+		t.Fatalf("NewResponderTransport returned %+v", err)
+	}
+	t.Cleanup(func() { rs.Close() })
+	host := "cast-" + id[:8] + ".local."
+	s := &mdns.Subject{}
+	s.FromString(host)
+	err = rs.Publish(mdns.Record{Subject: s, Type: mdns.RecordTypeA, Class: 0x8001, TTL: 120, Value: &mdns.RecordA{Addr: ip}})
+	if err != nil {
+		t.Fatalf("Responder.Publish returned %+v", err)
+	}
+	svc := &mdns.Service{
+		Instance: "Chromecast-" + id,
+		Type:     "_googlecast._tcp",
+		Host:     host,
+		Port:     8009,
+		Text:     castText(id, name, ""),
+	}
+	err = rs.Register(svc)
+	if err != nil {
+		t.Fatalf("Responder.Register returned %+v", err)
+	}
+	return rs, svc
+}
+
+func TestDiscovererFindsDevice(t *testing.T) {
+	vn := &mdns.VirtualNetwork{}
+	castDevice(t, vn, "0123456789abcdef0123456789abcdef", "Living Room", net.IPv4(10, 0, 0, 50))
+
+	d, err := chromecast.DiscoverTransport(vn, nil)
+	if err != nil {
+		t.Fatalf("DiscoverTransport returned %+v", err)
+	}
+	defer d.Stop()
+
+	var u *chromecast.DiscoveryUpdate
+	select {
+	case u = <-d.Chan:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no DiscoveryUpdate arrived")
+	}
+	if !u.Active || u.Kind != chromecast.DeviceAdded || u.Before != nil {
+		t.Errorf("the first DiscoveryUpdate was %+v", u)
+	}
+	k, err := d.Get(u.ID)
+	if err != nil {
+		t.Fatalf("Discoverer.Get returned %+v", err)
+	}
+	if *u.After != *k {
+		t.Errorf("DiscoveryUpdate.After is %+v, but Discoverer.Get returned %+v", *u.After, *k)
+	}
+	want := chromecast.KnownDevice{
+		ID:           chromecast.DeviceID{0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef, 0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef},
+		FriendlyName: "Living Room",
+		Hostname:     "cast-01234567.local.",
+		IPv4:         "10.0.0.50",
+		Model:        "Chromecast",
+		Port:         8009,
+		Capabilities: chromecast.CapabilityVideoOut | chromecast.CapabilityAudioOut | 4096,
+		Version:      "05",
+		Icon:         "/setup/icon.png",
+		BS:           0xFA8FCA000000,
+	}
+	if *k != want {
+		t.Errorf("Discoverer.Get returned %+v, not %+v", *k, want)
+	}
+}
+
+func TestDiscovererEvents(t *testing.T) {
+	vn := &mdns.VirtualNetwork{}
+	id := "00112233445566778899aabbccddeeff"
+	rs, svc := castDevice(t, vn, id, "Den", net.IPv4(10, 0, 0, 51))
+
+	d, err := chromecast.DiscoverTransport(vn, nil)
+	if err != nil {
+		t.Fatalf("DiscoverTransport returned %+v", err)
+	}
+	defer d.Stop()
+	d.SetQueryInterval(200 * time.Millisecond)
+
+	next := func() *chromecast.DiscoveryUpdate {
+		select {
+		case u := <-d.Chan:
+			return u
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no DiscoveryUpdate arrived")
+		}
+		return nil
+	}
+	u := next()
+	if u.Kind != chromecast.DeviceAdded || u.After.Status != "" || u.After.State != chromecast.StateIdle || !u.After.Capabilities.SupportsVideo() || u.After.Capabilities.IsGroup() {
+		t.Errorf("the device was discovered as %+v", u.After)
+	}
+
+	err = rs.SetText(svc, castText(id, "Den", "Spotify"))
+	if err != nil {
+		t.Fatalf("Responder.SetText returned %+v", err)
+	}
+	u = next()
+	if u.Kind != chromecast.DeviceUpdated || u.Changed != chromecast.FieldStatus|chromecast.FieldState || u.Before.Status != "" || u.After.Status != "Spotify" || u.After.State != chromecast.StateCasting {
+		t.Errorf("after a status change the update was %+v (changed %v)", u, u.Changed)
+	}
+
+	d.SetExpireRate(1)
+	rs.Close()
+	u = next()
+	if u.Kind != chromecast.DeviceRemoved || u.Active || u.After != nil || u.Before == nil || u.Before.Status != "Spotify" {
+		t.Errorf("after the device left the update was %+v", u)
+	}
+}
+
+func TestDiscovererSubscribers(t *testing.T) {
+	vn := &mdns.VirtualNetwork{}
+	castDevice(t, vn, "ffeeddccbbaa99887766554433221100", "Bedroom", net.IPv4(10, 0, 0, 52))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d, err := chromecast.DiscoverContext(ctx, vn, nil)
+	if err != nil {
+		t.Fatalf("DiscoverContext returned %+v", err)
+	}
+	defer d.Close()
+	ui := d.Subscribe(4)
+	logger := d.Subscribe(1)
+	dropped := d.Subscribe(1)
+	d.Unsubscribe(dropped)
+	if _, ok := <-dropped; ok {
+		t.Errorf("an unsubscribed channel was not closed")
+	}
+
+	// nobody reads Chan or logger, which must not hold up ui
+	for _, ch := range []<-chan *chromecast.DiscoveryUpdate{ui, logger} {
+		select {
+		case u := <-ch:
+			if u.Kind != chromecast.DeviceAdded || u.After.FriendlyName != "Bedroom" {
+				t.Errorf("a subscriber received %+v", u)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("a subscriber received no update")
+		}
+	}
+
+	cancel()
+	for _, ch := range []<-chan *chromecast.DiscoveryUpdate{ui, logger, d.Chan} {
+		for range ch {
+		}
+	}
+	if _, ok := <-d.Subscribe(1); ok {
+		t.Errorf("subscribing to a stopped Discoverer gave an open channel")
+	}
+}
+
+func TestDiscovererAnnouncements(t *testing.T) {
+	vn := &mdns.VirtualNetwork{}
+	d, err := chromecast.DiscoverTransport(vn, nil)
+	if err != nil {
+		t.Fatalf("DiscoverTransport returned %+v", err)
+	}
+	defer d.Close()
+
+	// the first query has been and gone, and the next is 20 seconds away, so
+	// only the announcement and goodbye can be heard in time
+	time.Sleep(1500 * time.Millisecond)
+	next := func(kind chromecast.UpdateKind) *chromecast.DiscoveryUpdate {
+		select {
+		case u := <-d.Chan:
+			if u.Kind != kind {
+				t.Fatalf("the update was %+v, not %v", u, kind)
+			}
+			return u
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no %v update arrived", kind)
+		}
+		return nil
+	}
+	rs, _ := castDevice(t, vn, "13371337133713371337133713371337", "Porch", net.IPv4(10, 0, 0, 53))
+	if u := next(chromecast.DeviceAdded); u.After.FriendlyName != "Porch" || u.After.IPv4 != "10.0.0.53" {
+		t.Errorf("the announced device was added as %+v", u.After)
+	}
+	rs.Close()
+	next(chromecast.DeviceRemoved)
+
+	// announced once with a short TTL, and never again
+	host, err := vn.Listen(nil, mdns.DefaultSocketOptions())
+	if err != nil {
+		t.Fatalf("VirtualNetwork.Listen returned %+v", err)
+	}
+	defer host.Close()
+	name := func(s string) *mdns.Subject {
+		sub := &mdns.Subject{}
+		sub.FromString(s)
+		return sub
+	}
+	inst := "Chromecast-abc._googlecast._tcp.local."
+	var txt strings.Builder
+	for _, s := range castText("abcabcabcabcabcabcabcabcabcabcab", "Shed", "") {
+		txt.WriteByte(byte(len(s)))
+		txt.WriteString(s)
+	}
+	m := &mdns.Message{Flags: 0x8400, Answer: []mdns.Record{
+		{Subject: name("_googlecast._tcp.local."), Type: mdns.RecordTypePTR, Class: 1, TTL: 2, Value: &mdns.RecordPTR{Name: *name(inst)}},
+		{Subject: name(inst), Type: mdns.RecordTypeSRV, Class: 0x8001, TTL: 2, Value: &mdns.RecordSRV{Port: 8009, Target: *name("shed.local.")}},
+		{Subject: name(inst), Type: mdns.RecordTypeTXT, Class: 0x8001, TTL: 2, Value: &mdns.RecordTXT{Text: txt.String()}},
+		{Subject: name("shed.local."), Type: mdns.RecordTypeA, Class: 0x8001, TTL: 2, Value: &mdns.RecordA{Addr: net.IPv4(10, 0, 0, 54)}},
+	}}
+	if _, err := host.WriteTo(m.Encode(), &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}); err != nil {
+		t.Fatalf("PacketConn.WriteTo returned %+v", err)
+	}
+	start := time.Now()
+	if u := next(chromecast.DeviceAdded); u.After.FriendlyName != "Shed" {
+		t.Errorf("the announced device was added as %+v", u.After)
+	}
+	next(chromecast.DeviceRemoved)
+	if e := time.Since(start); e < 1500*time.Millisecond {
+		t.Errorf("a device with a TTL of 2 seconds was removed after %v", e)
+	}
+}
+
+func TestDiscovererSlowResolve(t *testing.T) {
+	vn := &mdns.VirtualNetwork{}
+	d, err := chromecast.DiscoverTransport(vn, nil)
+	if err != nil {
+		t.Fatalf("DiscoverTransport returned %+v", err)
+	}
+	defer d.Close()
+	time.Sleep(1500 * time.Millisecond)
+
+	host, err := vn.Listen(nil, mdns.DefaultSocketOptions())
+	if err != nil {
+		t.Fatalf("VirtualNetwork.Listen returned %+v", err)
+	}
+	defer host.Close()
+	name := func(s string) *mdns.Subject {
+		sub := &mdns.Subject{}
+		sub.FromString(s)
+		return sub
+	}
+	announce := func(recs ...mdns.Record) {
+		m := &mdns.Message{Flags: 0x8400, Answer: recs}
+		if _, err := host.WriteTo(m.Encode(), &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}); err != nil {
+			t.Fatalf("PacketConn.WriteTo returned %+v", err)
+		}
+	}
+
+	// a device named but not described has to be asked about, and never answers
+	ghost := "Chromecast-ghost._googlecast._tcp.local."
+	announce(mdns.Record{Subject: name("_googlecast._tcp.local."), Type: mdns.RecordTypePTR, Class: 1, TTL: 120, Value: &mdns.RecordPTR{Name: *name(ghost)}})
+	time.Sleep(100 * time.Millisecond)
+
+	// which doesn't hold up another that describes itself whole meanwhile
+	inst := "Chromecast-hall._googlecast._tcp.local."
+	var txt strings.Builder
+	for _, s := range castText("5105105105105105105105105105105a", "Hall", "") {
+		txt.WriteByte(byte(len(s)))
+		txt.WriteString(s)
+	}
+	announce(
+		mdns.Record{Subject: name("_googlecast._tcp.local."), Type: mdns.RecordTypePTR, Class: 1, TTL: 120, Value: &mdns.RecordPTR{Name: *name(inst)}},
+		mdns.Record{Subject: name(inst), Type: mdns.RecordTypeSRV, Class: 0x8001, TTL: 120, Value: &mdns.RecordSRV{Port: 8009, Target: *name("hall.local.")}},
+		mdns.Record{Subject: name(inst), Type: mdns.RecordTypeTXT, Class: 0x8001, TTL: 120, Value: &mdns.RecordTXT{Text: txt.String()}},
+		mdns.Record{Subject: name("hall.local."), Type: mdns.RecordTypeA, Class: 0x8001, TTL: 120, Value: &mdns.RecordA{Addr: net.IPv4(10, 0, 0, 55)}},
+	)
+	select {
+	case u := <-d.Chan:
+		if u.Kind != chromecast.DeviceAdded || u.After.FriendlyName != "Hall" {
+			t.Errorf("the update was %+v", u)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("the described device waited on the one being asked about")
+	}
+}
@@ -0,0 +1,106 @@
+package chromecast
+
+import "strings"
+
+// UpdateKind says what happened to the device a DiscoveryUpdate is about.
+type UpdateKind int
+
+// The kinds of DiscoveryUpdate.
+const (
+	DeviceAdded   UpdateKind = iota + 1 // newly discovered
+	DeviceUpdated                       // already known, but something about it changed
+	DeviceRemoved                       // said goodbye, or not heard from for too long, and forgotten
+)
+
+func (k UpdateKind) String() string {
+	switch k {
+	case DeviceAdded:
+		return "added"
+	case DeviceUpdated:
+		return "updated"
+	case DeviceRemoved:
+		return "removed"
+	}
+	return "unknown"
+}
+
+// DiscoveryUpdate informs a goroutine reading a Discover channel when a Chromecast
+// is newly discovered, changes, or becomes unreachable. Before and After are copies
+// of the device as it was and now is, taken when the update was made, so there is
+// no need to call Get (which fails for a removed device anyway). Before is nil for
+// DeviceAdded, and After is nil for DeviceRemoved.
+type DiscoveryUpdate struct {
+	ID      DeviceID
+	Active  bool // false only for DeviceRemoved
+	Kind    UpdateKind
+	Changed DeviceFields // for DeviceUpdated, which fields differ
+	Before  *KnownDevice
+	After   *KnownDevice
+}
+
+// DeviceFields is a set of the fields of KnownDevice.
+type DeviceFields uint32
+
+// The fields of KnownDevice that can change. ID never does.
+const (
+	FieldFriendlyName DeviceFields = 1 << iota
+	FieldHostname
+	FieldIPv4
+	FieldIPv6
+	FieldModel
+	FieldPort
+	FieldCapabilities
+	FieldStatus
+	FieldState
+	FieldVersion
+	FieldIcon
+	FieldBS
+	FieldEBS
+	FieldStale
+)
+
+var fieldNames = []string{"FriendlyName", "Hostname", "IPv4", "IPv6", "Model", "Port", "Capabilities", "Status", "State", "Version", "Icon", "BS", "EBS", "Stale"}
+
+// Has reports whether f includes every field in g.
+func (f DeviceFields) Has(g DeviceFields) bool {
+	return f&g == g
+}
+
+func (f DeviceFields) String() string {
+	var names []string
+	for i, n := range fieldNames {
+		if f&(1<<i) != 0 {
+			names = append(names, n)
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+// diffDevices returns the fields in which a and b differ.
+func diffDevices(a, b *KnownDevice) DeviceFields {
+	var f DeviceFields
+	for _, c := range []struct {
+		field DeviceFields
+		same  bool
+	}{
+		{FieldFriendlyName, a.FriendlyName == b.FriendlyName},
+		{FieldHostname, a.Hostname == b.Hostname},
+		{FieldIPv4, a.IPv4 == b.IPv4},
+		{FieldIPv6, a.IPv6 == b.IPv6},
+		{FieldModel, a.Model == b.Model},
+		{FieldPort, a.Port == b.Port},
+		{FieldCapabilities, a.Capabilities == b.Capabilities},
+		{FieldStatus, a.Status == b.Status},
+		{FieldState, a.State == b.State},
+		{FieldVersion, a.Version == b.Version},
+		{FieldIcon, a.Icon == b.Icon},
+		{FieldBS, a.BS == b.BS},
+		{FieldEBS, a.EBS == b.EBS},
+		{FieldStale, a.Stale == b.Stale},
+	} {
+		if !c.same {
+			f |= c.field
+		}
+	}
+	return f
+}
@@ -0,0 +1,180 @@
+package chromecast
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A Predicate picks out devices, for Filter and WaitFor.
+type Predicate func(*KnownDevice) bool
+
+// ModelIs matches devices whose Model is model, ignoring case.
+func ModelIs(model string) Predicate {
+	return func(k *KnownDevice) bool {
+		return strings.EqualFold(k.Model, model)
+	}
+}
+
+// HasCapabilities matches devices with every capability in c.
+func HasCapabilities(c Capabilities) Predicate {
+	return func(k *KnownDevice) bool {
+		return k.Capabilities&c == c
+	}
+}
+
+// NameIs matches devices whose FriendlyName is name, ignoring case.
+func NameIs(name string) Predicate {
+	return func(k *KnownDevice) bool {
+		return strings.EqualFold(k.FriendlyName, name)
+	}
+}
+
+// List returns copies of every known device, sorted by FriendlyName (ignoring
+// case) and then by ID.
+func (d *Discoverer) List() []*KnownDevice {
+	d.mu.RLock()
+	l := make([]*KnownDevice, 0, len(d.devs))
+	for _, k := range d.devs {
+		l = append(l, k.export())
+	}
+	d.mu.RUnlock()
+	sort.Slice(l, func(i, j int) bool {
+		a, b := strings.ToLower(l[i].FriendlyName), strings.ToLower(l[j].FriendlyName)
+		if a != b {
+			return a < b
+		}
+		return string(l[i].ID[:]) < string(l[j].ID[:])
+	})
+	return l
+}
+
+// Filter returns the devices List would that match every one of ps.
+func (d *Discoverer) Filter(ps ...Predicate) []*KnownDevice {
+	var l []*KnownDevice
+	for _, k := range d.List() {
+		if matchAll(k, ps) {
+			l = append(l, k)
+		}
+	}
+	return l
+}
+
+func matchAll(k *KnownDevice, ps []Predicate) bool {
+	for _, p := range ps {
+		if !p(k) {
+			return false
+		}
+	}
+	return true
+}
+
+// FindByName returns the known device whose FriendlyName best matches name. An
+// exact match (ignoring case) is best; then a name starting with name; then one
+// containing it; then one within a couple of typos of it. It is an error if no
+// device matches, or if several match equally well.
+func (d *Discoverer) FindByName(name string) (*KnownDevice, error) {
+	want := strings.ToLower(strings.TrimSpace(name))
+	var best []*KnownDevice
+	bestScore := -1
+	for _, k := range d.List() {
+		s := nameScore(want, strings.ToLower(k.FriendlyName))
+		switch {
+		case s < 0 || (bestScore >= 0 && s > bestScore):
+		case s == bestScore:
+			best = append(best, k)
+		default:
+			best, bestScore = []*KnownDevice{k}, s
+		}
+	}
+	switch len(best) {
+	case 0:
+		return nil, fmt.Errorf("no known device is named like %q", name)
+	case 1:
+		return best[0], nil
+	}
+	names := make([]string, len(best))
+	for i, k := range best {
+		names[i] = fmt.Sprintf("%q", k.FriendlyName)
+	}
+	return nil, fmt.Errorf("%q could be any of %s", name, strings.Join(names, ", "))
+}
+
+// nameScore rates how well have matches want, both lowered: 0 is exact, and
+// larger is worse. It is -1 if have doesn't match at all.
+func nameScore(want, have string) int {
+	switch {
+	case want == "":
+		return -1
+	case have == want:
+		return 0
+	case strings.HasPrefix(have, want):
+		return 1
+	case strings.Contains(have, want):
+		return 2
+	}
+	// allow a typo for every few letters, up to a limit
+	limit := len(want)/4 + 1
+	if limit > 3 {
+		limit = 3
+	}
+	if e := editDistance(want, have); e <= limit {
+		return 2 + e
+	}
+	return -1
+}
+
+// editDistance is the Levenshtein distance between a and b, in bytes.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			c := prev[j-1]
+			if a[i-1] != b[j-1] {
+				c++
+			}
+			c = min(c, prev[j]+1, cur[j-1]+1)
+			cur[j] = c
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// WaitFor returns a copy of a device matching every one of ps, waiting until one
+// is discovered (or changes so as to match) if none is known yet. It fails if ctx
+// is done or the Discoverer stops first.
+//
+// Since a subscription drops its oldest updates when it falls behind, the known
+// devices are searched again with every update that doesn't match itself.
+func (d *Discoverer) WaitFor(ctx context.Context, ps ...Predicate) (*KnownDevice, error) {
+	ch := d.Subscribe(chanBuffer)
+	defer d.Unsubscribe(ch)
+	if l := d.Filter(ps...); len(l) > 0 {
+		return l[0], nil
+	}
+	for {
+		select {
+		case u, ok := <-ch:
+			if !ok {
+				return nil, fmt.Errorf("discoverer stopped")
+			}
+			if u.After != nil && matchAll(u.After, ps) {
+				// the update is shared with every other subscriber
+				k := *u.After
+				return &k, nil
+			}
+			if l := d.Filter(ps...); len(l) > 0 {
+				return l[0], nil
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package chromecast_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ironiridis/klonderoo/chromecast"
+	"github.com/ironiridis/klonderoo/mdns"
+)
+
+func TestDiscovererFind(t *testing.T) {
+	vn := &mdns.VirtualNetwork{}
+	castDevice(t, vn, "11111111111111111111111111111111", "Living Room", net.IPv4(10, 0, 0, 61))
+	castDevice(t, vn, "22222222222222222222222222222222", "Kitchen Speaker", net.IPv4(10, 0, 0, 62))
+	castDevice(t, vn, "33333333333333333333333333333333", "bedroom", net.IPv4(10, 0, 0, 63))
+
+	d, err := chromecast.DiscoverTransport(vn, nil)
+	if err != nil {
+		t.Fatalf("DiscoverTransport returned %+v", err)
+	}
+	defer d.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, name := range []string{"Living Room", "Kitchen Speaker", "Bedroom"} {
+		_, err := d.WaitFor(ctx, chromecast.NameIs(name))
+		if err != nil {
+			t.Fatalf("WaitFor(NameIs(%q)) returned %+v", name, err)
+		}
+	}
+
+	l := d.List()
+	if len(l) != 3 || l[0].FriendlyName != "bedroom" || l[1].FriendlyName != "Kitchen Speaker" || l[2].FriendlyName != "Living Room" {
+		t.Errorf("List returned %+v", l)
+	}
+	if l := d.Filter(chromecast.ModelIs("chromecast"), chromecast.HasCapabilities(chromecast.CapabilityAudioOut)); len(l) != 3 {
+		t.Errorf("Filter returned %d devices, not 3", len(l))
+	}
+	if l := d.Filter(chromecast.HasCapabilities(chromecast.CapabilityMultizoneGroup)); len(l) != 0 {
+		t.Errorf("Filter found %d groups", len(l))
+	}
+
+	for name, want := range map[string]string{
+		"LIVING ROOM": "Living Room",
+		"kitch":       "Kitchen Speaker",
+		"speaker":     "Kitchen Speaker",
+		"Bedrom":      "bedroom",
+	} {
+		k, err := d.FindByName(name)
+		if err != nil || k.FriendlyName != want {
+			t.Errorf("FindByName(%q) returned %+v, %+v", name, k, err)
+		}
+	}
+	for _, name := range []string{"room", "garage", ""} {
+		k, err := d.FindByName(name)
+		if err == nil {
+			t.Errorf("FindByName(%q) returned %+v", name, k)
+		}
+	}
+
+	short, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = d.WaitFor(short, chromecast.NameIs("Garage"))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("WaitFor of a missing device returned %+v", err)
+	}
+}
+
+func TestDiscovererWaitForCopy(t *testing.T) {
+	vn := &mdns.VirtualNetwork{}
+	d, err := chromecast.DiscoverTransport(vn, nil)
+	if err != nil {
+		t.Fatalf("DiscoverTransport returned %+v", err)
+	}
+	defer d.Close()
+	other := d.Subscribe(4)
+	castDevice(t, vn, "44444444444444444444444444444444", "Study", net.IPv4(10, 0, 0, 64))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	k, err := d.WaitFor(ctx, chromecast.NameIs("Study"))
+	if err != nil {
+		t.Fatalf("WaitFor returned %+v", err)
+	}
+	k.FriendlyName = "Changed"
+	select {
+	case u := <-other:
+		if u.After.FriendlyName != "Study" {
+			t.Errorf("changing the device WaitFor returned changed another subscriber's to %q", u.After.FriendlyName)
+		}
+	case <-ctx.Done():
+		t.Fatalf("the other subscriber received no update")
+	}
+	if l := d.List(); len(l) != 1 || l[0].FriendlyName != "Study" {
+		t.Errorf("List returned %+v", l)
+	}
+}
@@ -0,0 +1,365 @@
+package chromecast
+
+import (
+	"strings"
+	"time"
+
+	"github.com/ironiridis/klonderoo/mdns"
+)
+
+// maxBackoff bounds how many times the query interval the querier waits between
+// queries while nothing changes.
+const maxBackoff = 16
+
+// refreshPoints are the fractions of a device's lifetime after which it is queried
+// for again, if not heard from in the meantime, before it is forgotten at the end
+// (after RFC 6762 sec 5.2).
+var refreshPoints = []float64{0.8, 0.9, 1}
+
+// querier runs the Discoverer: it queries when due, handles what the listener
+// hears in between, and forgets devices as they expire.
+func (d *Discoverer) querier() {
+	defer d.wg.Done()
+	defer d.closeSubscribers()
+	defer d.saveCacheFile()
+	defer d.resolving.Wait()
+
+	heard := make(chan []mdns.Record)
+	tr := d.tr
+	if tr == nil {
+		tr = mdns.UDPTransport{}
+	}
+	conn, err := tr.Listen(d.ifc, mdns.DefaultSocketOptions())
+	if err == nil {
+		// without a listener, devices are still found by querying
+		defer conn.Close()
+		d.wg.Add(1)
+		go d.listen(conn, heard)
+	}
+
+	// run one round of queries immediately
+	d.query()
+	wait := d.interval()
+	last := time.Now()
+	d.takeChanged()
+
+	for {
+		when, query := d.nextWake(last.Add(wait))
+		t := time.NewTimer(time.Until(when))
+		select {
+		case <-d.ctx.Done():
+			t.Stop()
+			return
+		case recs := <-heard:
+			t.Stop()
+			d.process(recs)
+			if d.takeChanged() {
+				wait = d.interval()
+			}
+		case <-d.wake:
+			t.Stop()
+			wait = d.interval()
+		case <-t.C:
+			d.expireCheck()
+			if !query {
+				continue
+			}
+			d.query()
+			last = time.Now()
+			if d.takeChanged() {
+				wait = d.interval()
+			} else if wait *= 2; wait > maxBackoff*d.interval() {
+				wait = maxBackoff * d.interval()
+			}
+		}
+	}
+}
+
+// query runs a round of queries and probes, then forgets the cached devices the
+// round didn't confirm, whether or not the queries were answered. Registered
+// devices are probed first, so that one loaded from the cache is kept. The
+// querier doesn't wait for the devices that answered to be resolved; the cache
+// is expired once they are.
+func (d *Discoverer) query() {
+	d.mu.Lock()
+	d.round++
+	round := d.round
+	d.mu.Unlock()
+	pending := d.mdnsQuery()
+	d.probeStatic()
+	d.resolving.Add(1)
+	go func() {
+		defer d.resolving.Done()
+		for _, p := range pending {
+			<-p.done
+		}
+		d.expireStale(round)
+	}()
+}
+
+func (d *Discoverer) interval() time.Duration {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.queryinterval
+}
+
+// reschedule has the querier start its backoff over, and reconsider when to wake.
+func (d *Discoverer) reschedule() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// takeChanged reports whether an update has been sent since it was last called.
+func (d *Discoverer) takeChanged() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	c := d.changed
+	d.changed = false
+	return c
+}
+
+// peekChanged reports whether an update has been sent since takeChanged was last
+// called, leaving that for takeChanged to report too.
+func (d *Discoverer) peekChanged() bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.changed
+}
+
+// lifetime returns when k was last heard from, and how long it lasts after that.
+// d.mu must be held.
+func (d *Discoverer) lifetime(k *knownDevice) (time.Time, time.Duration) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if k.ttl > 0 {
+		return k.lastSeen, k.ttl
+	}
+	return k.lastSeen, time.Duration(d.expireRate) * d.queryinterval
+}
+
+// nextWake returns when the querier must next wake: at due, or sooner if a device
+// reaches one of its refreshPoints first. It also reports whether to query then,
+// which there is no need to do just to forget a device at the end of its life.
+func (d *Discoverer) nextWake(due time.Time) (time.Time, bool) {
+	now := time.Now()
+	query := true
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, k := range d.devs {
+		if k.Stale {
+			continue
+		}
+		t, life := d.lifetime(k)
+		// past every point, the device is due to be forgotten now
+		p, refresh := now, false
+		for _, f := range refreshPoints {
+			if pf := t.Add(time.Duration(f * float64(life))); pf.After(now) {
+				p, refresh = pf, f < 1
+				break
+			}
+		}
+		if p.Before(due) {
+			due, query = p, refresh
+		}
+	}
+	return due, query
+}
+
+// listen reads every response on the link, whether it answers a query of ours or
+// is announced unsolicited, and hands those about Chromecasts to the querier.
+func (d *Discoverer) listen(conn mdns.PacketConn, heard chan<- []mdns.Record) {
+	defer d.wg.Done()
+	buf := make([]byte, mdns.MaximumPacketSize)
+	for {
+		n, _, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		m := &mdns.Message{}
+		if m.Decode(buf[:n], 1000) != nil || !m.IsResponse() {
+			continue
+		}
+		recs := append(m.Answer, m.Additional...)
+		if !aboutCast(recs) {
+			continue
+		}
+		select {
+		case heard <- recs:
+		case <-d.ctx.Done():
+			return
+		}
+	}
+}
+
+// aboutCast reports whether any of recs names the Cast service or an instance of
+// it. Address records alone are not enough; process finds those by hostname.
+func aboutCast(recs []mdns.Record) bool {
+	for i := range recs {
+		name := recs[i].Subject.String()
+		if strings.EqualFold(name, castService) || isInstance(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// isInstance reports whether name is that of an instance of the Cast service.
+func isInstance(name string) bool {
+	return len(name) > len(castService)+1 && strings.EqualFold(name[len(name)-len(castService)-1:], "."+castService)
+}
+
+// process handles the records of a response, whether to a query or unsolicited.
+// Devices saying goodbye (RFC 6762 sec 10.1) are forgotten at once, and the rest
+// mentioned are found. Since resolving a device may mean asking the network for
+// what recs leave out, that is left to resolveInstance, and process returns the
+// resolutions it started or added to. It must only be called by the querier.
+func (d *Discoverer) process(recs []mdns.Record) []*pendingResolve {
+	var insts []string
+	mention := func(inst string) {
+		for _, i := range insts {
+			if strings.EqualFold(i, inst) {
+				return
+			}
+		}
+		insts = append(insts, inst)
+	}
+	for i := range recs {
+		r := &recs[i]
+		name := r.Subject.String()
+		switch v := r.Value.(type) {
+		case *mdns.RecordPTR:
+			if !strings.EqualFold(name, castService) {
+				continue
+			}
+			if r.TTL == 0 {
+				d.goodbye(v.Name.String())
+			} else {
+				mention(v.Name.String())
+			}
+		case *mdns.RecordSRV:
+			if !isInstance(name) {
+				continue
+			}
+			if r.TTL == 0 {
+				d.goodbye(name)
+			} else {
+				mention(name)
+			}
+		case *mdns.RecordTXT:
+			// a TXT record's goodbye only makes way for a new one
+			if isInstance(name) && r.TTL > 0 {
+				mention(name)
+			}
+		case *mdns.RecordA, *mdns.RecordAAAA:
+			if r.TTL == 0 {
+				continue
+			}
+			d.mu.RLock()
+			inst := d.instanceOf(name)
+			d.mu.RUnlock()
+			if inst != "" {
+				mention(inst)
+			}
+		}
+	}
+	pending := make([]*pendingResolve, 0, len(insts))
+	for _, inst := range insts {
+		key := strings.ToLower(inst)
+		d.mu.Lock()
+		p, busy := d.pending[key]
+		if !busy {
+			p = &pendingResolve{done: make(chan struct{})}
+			d.pending[key] = p
+		}
+		pending = append(pending, p)
+		// the newest records come first, so that resolve finds them first
+		p.recs = append(recs[:len(recs):len(recs)], p.recs...)
+		p.gone = false
+		d.mu.Unlock()
+		if !busy {
+			d.resolving.Add(1)
+			go d.resolveInstance(inst, p)
+		}
+	}
+	return pending
+}
+
+// A pendingResolve holds what has been heard about a service instance while it
+// is being resolved.
+type pendingResolve struct {
+	recs []mdns.Record // heard since resolving last began
+	gone bool          // whether a goodbye was heard since
+	done chan struct{} // closed once resolving is over
+}
+
+// resolveInstance resolves the service instance inst, and finds the device, until
+// nothing more has been heard about it. One runs for each instance at a time, so
+// that the records heard about it are taken in turn.
+func (d *Discoverer) resolveInstance(inst string, p *pendingResolve) {
+	defer d.resolving.Done()
+	defer close(p.done)
+	key := strings.ToLower(inst)
+	for {
+		d.mu.Lock()
+		recs := p.recs
+		p.recs, p.gone = nil, false
+		if recs == nil {
+			delete(d.pending, key)
+		}
+		d.mu.Unlock()
+		if recs == nil {
+			return
+		}
+
+		n, ttl, ok := d.resolve(inst, recs)
+		d.mu.RLock()
+		ok = ok && !p.gone
+		d.mu.RUnlock()
+		if !ok {
+			continue
+		}
+		d.found(n, inst, ttl)
+		if d.peekChanged() {
+			// start the backoff over, as a change heard by the querier does
+			d.reschedule()
+		}
+	}
+}
+
+// goodbye forgets the device known as the service instance inst, and drops what
+// is being resolved for it.
+func (d *Discoverer) goodbye(inst string) {
+	d.mu.Lock()
+	k := d.byInstance(inst)
+	if p := d.pending[strings.ToLower(inst)]; p != nil {
+		p.recs, p.gone = nil, true
+	}
+	d.mu.Unlock()
+	if k != nil {
+		d.forget(k.ID)
+	}
+}
+
+// byInstance returns the device known as the service instance inst, or nil. d.mu
+// must be held.
+func (d *Discoverer) byInstance(inst string) *knownDevice {
+	for _, k := range d.devs {
+		if k.inst != "" && strings.EqualFold(k.inst, inst) {
+			return k
+		}
+	}
+	return nil
+}
+
+// instanceOf returns the service instance name of the device discovered on host,
+// or "". d.mu must be held.
+func (d *Discoverer) instanceOf(host string) string {
+	for _, k := range d.devs {
+		if k.inst != "" && strings.EqualFold(k.Hostname, host) {
+			return k.inst
+		}
+	}
+	return ""
+}
@@ -0,0 +1,168 @@
+package chromecast
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// castPort is the usual port of the Cast protocol. A device serves its device info
+// endpoint over HTTP on the port below its Cast port: 8008, for the usual one.
+const castPort = 8009
+
+// eurekaInfo is the part of the device info endpoint's response that is used.
+type eurekaInfo struct {
+	Name       string `json:"name"`
+	SSDPUDN    string `json:"ssdp_udn"`
+	DeviceInfo struct {
+		ModelName    string `json:"model_name"`
+		Capabilities struct {
+			Display bool `json:"display_supported"`
+		} `json:"capabilities"`
+	} `json:"device_info"`
+}
+
+// Register adds the Chromecast at addr, a hostname or IP address with an optional
+// Cast port (8009 by default), for networks where mDNS doesn't reach it. The device
+// is verified by connecting to its Cast port and reading its device info endpoint,
+// on the port below, which gives the rest of its KnownDevice; its Version is only
+// known once mDNS discovers it. Once registered, it is probed again with
+// every round of queries, and comes and goes just as a discovered device does. A
+// device that is also discovered by mDNS is the same device, and mDNS is trusted
+// for its fields.
+func (d *Discoverer) Register(addr string) (*KnownDevice, error) {
+	addr = staticAddr(addr)
+	ctx, cancel := context.WithTimeout(d.ctx, resolveTimeout)
+	defer cancel()
+	n, err := probe(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	d.mu.Lock()
+	d.static[addr] = true
+	d.mu.Unlock()
+	d.foundStatic(n)
+	return d.Get(n.ID)
+}
+
+// Unregister stops probing the device registered at addr. It is forgotten in time
+// unless mDNS discovers it.
+func (d *Discoverer) Unregister(addr string) {
+	d.mu.Lock()
+	delete(d.static, staticAddr(addr))
+	d.mu.Unlock()
+}
+
+// staticAddr gives addr as host:port, adding the Cast port if it has none.
+func staticAddr(addr string) string {
+	if _, _, err := net.SplitHostPort(addr); err == nil {
+		return addr
+	}
+	return net.JoinHostPort(strings.Trim(addr, "[]"), strconv.Itoa(castPort))
+}
+
+// probeStatic probes every registered device, so that those reachable are kept.
+func (d *Discoverer) probeStatic() {
+	d.mu.RLock()
+	addrs := make([]string, 0, len(d.static))
+	for a := range d.static {
+		addrs = append(addrs, a)
+	}
+	d.mu.RUnlock()
+	for _, a := range addrs {
+		ctx, cancel := context.WithTimeout(d.ctx, resolveTimeout)
+		n, err := probe(ctx, a)
+		cancel()
+		if err == nil {
+			d.foundStatic(n)
+		}
+	}
+}
+
+// foundStatic is found for a device that answered a probe. A device mDNS has
+// discovered is only touched, since its probe can't give its TXT record fields.
+func (d *Discoverer) foundStatic(n *KnownDevice) {
+	d.mu.RLock()
+	k, ok := d.devs[n.ID]
+	d.mu.RUnlock()
+	if ok && k.inst != "" {
+		k.touch(0)
+		return
+	}
+	d.found(n, "", 0)
+}
+
+// probe verifies that a Chromecast listens at addr, and builds its KnownDevice
+// from its device info endpoint.
+func probe(ctx context.Context, addr string) (*KnownDevice, error) {
+	host, p, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(p, 10, 16)
+	if err != nil || port < 2 {
+		return nil, fmt.Errorf("invalid port in %q", addr)
+	}
+
+	var dl net.Dialer
+	c, err := dl.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("no Cast service at %s: %w", addr, err)
+	}
+	c.Close()
+
+	u := "http://" + net.JoinHostPort(host, strconv.Itoa(int(port)-1)) + "/setup/eureka_info"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("no device info from %s: %w", host, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("device info from %s: %s", host, resp.Status)
+	}
+	var info eurekaInfo
+	err = json.NewDecoder(resp.Body).Decode(&info)
+	if err != nil {
+		return nil, fmt.Errorf("device info from %s: %w", host, err)
+	}
+	id, err := ParseDeviceID(info.SSDPUDN)
+	if err != nil {
+		return nil, fmt.Errorf("device info from %s: %w", host, err)
+	}
+
+	n := &KnownDevice{
+		ID:           id,
+		FriendlyName: info.Name,
+		Model:        info.DeviceInfo.ModelName,
+		Port:         uint16(port),
+		Capabilities: CapabilityAudioOut,
+	}
+	if info.DeviceInfo.Capabilities.Display {
+		n.Capabilities |= CapabilityVideoOut
+	}
+	ips := []net.IP{net.ParseIP(host)}
+	if ips[0] == nil {
+		n.Hostname = host
+		ips, err = net.DefaultResolver.LookupIP(ctx, "ip", host)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, ip := range ips {
+		switch {
+		case ip.To4() != nil && n.IPv4 == "":
+			n.IPv4 = ip.String()
+		case ip.To4() == nil && n.IPv6 == "":
+			n.IPv6 = ip.String()
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,159 @@
+package chromecast_test
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ironiridis/klonderoo/chromecast"
+	"github.com/ironiridis/klonderoo/mdns"
+)
+
+// staticDevice serves a Cast port and, on the port below, a device info endpoint
+// on ip, as a Chromecast does, skipping the test if it can't.
+func staticDevice(t *testing.T, ip string, port int, udn, name string) {
+	cast, err := net.Listen("tcp", net.JoinHostPort(ip, strconv.Itoa(port)))
+	if err != nil {
+		t.Skipf("can't listen on the Cast port: %v", err)
+	}
+	t.Cleanup(func() { cast.Close() })
+	go func() {
+		for {
+			c, err := cast.Accept()
+			if err != nil {
+				return
+			}
+			c.Close()
+		}
+	}()
+	info, err := net.Listen("tcp", net.JoinHostPort(ip, strconv.Itoa(port-1)))
+	if err != nil {
+		t.Skipf("can't listen on the device info port: %v", err)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/setup/eureka_info" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, `{"name": %q, "ssdp_udn": %q, "version": 12, "device_info": {"model_name": "Chromecast", "capabilities": {"display_supported": true}}}`, name, udn)
+	})}
+	go srv.Serve(info)
+	t.Cleanup(func() { srv.Close() })
+}
+
+func TestDiscovererRegister(t *testing.T) {
+	staticDevice(t, "127.0.48.1", 8009, "0badcafe-0000-1111-2222-333344445555", "Garage")
+	vn := &mdns.VirtualNetwork{}
+	d, err := chromecast.DiscoverTransport(vn, nil)
+	if err != nil {
+		t.Fatalf("DiscoverTransport returned %+v", err)
+	}
+	defer d.Close()
+	d.SetQueryInterval(200 * time.Millisecond)
+
+	if _, err := d.Register("127.0.48.2"); err == nil {
+		t.Errorf("registering an address with no device succeeded")
+	}
+	k, err := d.Register("127.0.48.1")
+	if err != nil {
+		t.Fatalf("Discoverer.Register returned %+v", err)
+	}
+	want := chromecast.KnownDevice{
+		ID:           chromecast.DeviceID{0x0b, 0xad, 0xca, 0xfe, 0, 0, 0x11, 0x11, 0x22, 0x22, 0x33, 0x33, 0x44, 0x44, 0x55, 0x55},
+		FriendlyName: "Garage",
+		IPv4:         "127.0.48.1",
+		Model:        "Chromecast",
+		Port:         8009,
+		Capabilities: chromecast.CapabilityVideoOut | chromecast.CapabilityAudioOut,
+	}
+	if *k != want {
+		t.Errorf("Discoverer.Register returned %+v, not %+v", *k, want)
+	}
+
+	// once mDNS finds it too, its TXT record is used instead
+	castDevice(t, vn, "0badcafe000011112222333344445555", "Garage", net.IPv4(127, 0, 48, 1))
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case u := <-d.Chan:
+			if u.Kind == chromecast.DeviceRemoved {
+				t.Fatalf("the registered device was removed")
+			}
+			if u.Kind == chromecast.DeviceUpdated && u.After.Hostname != "" {
+				if l := d.List(); len(l) != 1 {
+					t.Errorf("after merging there are %d devices", len(l))
+				}
+				return
+			}
+		case <-deadline:
+			t.Fatalf("mDNS never described the registered device")
+		}
+	}
+}
+
+func TestDiscovererRegisterCached(t *testing.T) {
+	staticDevice(t, "127.0.48.3", 8009, "0badcafe-0000-1111-2222-333344445566", "Shed")
+	path := filepath.Join(t.TempDir(), "devices.json")
+	d, err := chromecast.DiscoverTransport(&mdns.VirtualNetwork{}, nil)
+	if err != nil {
+		t.Fatalf("DiscoverTransport returned %+v", err)
+	}
+	if _, err := d.Register("127.0.48.3"); err != nil {
+		t.Fatalf("Discoverer.Register returned %+v", err)
+	}
+	if err := d.SaveCache(path); err != nil {
+		t.Fatalf("SaveCache returned %+v", err)
+	}
+	d.Close()
+
+	// loaded from the cache and registered again, the device is kept through
+	// every round of queries
+	d, err = chromecast.DiscoverTransport(&mdns.VirtualNetwork{}, nil)
+	if err != nil {
+		t.Fatalf("DiscoverTransport returned %+v", err)
+	}
+	defer d.Close()
+	d.SetQueryInterval(200 * time.Millisecond)
+	if err := d.LoadCache(path); err != nil {
+		t.Fatalf("LoadCache returned %+v", err)
+	}
+	if _, err := d.Register("127.0.48.3"); err != nil {
+		t.Fatalf("Discoverer.Register returned %+v", err)
+	}
+	deadline := time.After(time.Second)
+	for {
+		select {
+		case u := <-d.Chan:
+			if u.Kind == chromecast.DeviceRemoved {
+				t.Fatalf("the registered device was removed")
+			}
+		case <-deadline:
+			if l := d.List(); len(l) != 1 || l[0].Stale {
+				t.Errorf("the devices were %+v, expected the registered device, confirmed", l)
+			}
+			return
+		}
+	}
+}
+
+func TestDiscovererRegisterPort(t *testing.T) {
+	staticDevice(t, "127.0.48.4", 18009, "0badcafe-0000-1111-2222-333344445577", "Attic")
+	d, err := chromecast.DiscoverTransport(&mdns.VirtualNetwork{}, nil)
+	if err != nil {
+		t.Fatalf("DiscoverTransport returned %+v", err)
+	}
+	defer d.Close()
+
+	// the device info endpoint is found on the port below the Cast port
+	k, err := d.Register("127.0.48.4:18009")
+	if err != nil {
+		t.Fatalf("Discoverer.Register returned %+v", err)
+	}
+	if k.FriendlyName != "Attic" || k.Port != 18009 || k.Version != "" {
+		t.Errorf("Discoverer.Register returned %+v", *k)
+	}
+}
@@ -0,0 +1,67 @@
+package chromecast
+
+// chanBuffer is how many updates Chan holds for a reader that falls behind.
+const chanBuffer = 16
+
+// Subscribe returns a channel that receives every DiscoveryUpdate made from now on.
+// It holds up to buffer updates (at least 1) that have not been read yet. When a
+// subscriber falls further behind than that, the oldest update waiting for it is
+// dropped to make room for the newest, so a slow subscriber never holds up discovery
+// or the other subscribers. The channel is closed by Unsubscribe, or when the
+// Discoverer stops.
+func (d *Discoverer) Subscribe(buffer int) <-chan *DiscoveryUpdate {
+	if buffer < 1 {
+		buffer = 1
+	}
+	ch := make(chan *DiscoveryUpdate, buffer)
+	d.subMu.Lock()
+	defer d.subMu.Unlock()
+	if d.subs == nil {
+		// already stopped
+		close(ch)
+		return ch
+	}
+	d.subs[ch] = ch
+	return ch
+}
+
+// Unsubscribe stops updates being sent to ch, a channel returned by Subscribe, and
+// closes it.
+func (d *Discoverer) Unsubscribe(ch <-chan *DiscoveryUpdate) {
+	d.subMu.Lock()
+	defer d.subMu.Unlock()
+	if c, ok := d.subs[ch]; ok {
+		delete(d.subs, ch)
+		close(c)
+	}
+}
+
+// send delivers u to every subscriber, dropping their oldest updates as needed.
+func (d *Discoverer) send(u *DiscoveryUpdate) {
+	d.subMu.Lock()
+	defer d.subMu.Unlock()
+	for _, ch := range d.subs {
+		for {
+			select {
+			case ch <- u:
+			default:
+				select {
+				case <-ch:
+				default:
+				}
+				continue
+			}
+			break
+		}
+	}
+}
+
+// closeSubscribers closes every subscriber's channel, for when the Discoverer stops.
+func (d *Discoverer) closeSubscribers() {
+	d.subMu.Lock()
+	defer d.subMu.Unlock()
+	for _, ch := range d.subs {
+		close(ch)
+	}
+	d.subs = nil
+}
@@ -0,0 +1,339 @@
+package mdns
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// bridgeNegativeTTL is how long a Bridge remembers that a name or type went
+// unanswered on the link.
+const bridgeNegativeTTL = 10 * time.Second
+
+// bridgeUDPSize is the largest response a Bridge sends over UDP (RFC 1035
+// sec 4.2.1); clients that need more retry over TCP.
+const bridgeUDPSize = 512
+
+// bridgeQueryTimeout is how long a Bridge waits for the link to answer. A
+// responder answers within 500ms even when it delays to aggregate answers (RFC
+// 6762 sec 6), so there is no sense keeping a unicast client waiting longer.
+const bridgeQueryTimeout = 500 * time.Millisecond
+
+// bridgeUDPWorkers is how many UDP queries a Bridge answers at once. Beyond
+// that, datagrams wait in the socket's buffer, and are dropped once it fills.
+const bridgeUDPWorkers = 32
+
+// A Querier asks a question of the network and returns every record heard in
+// reply. Resolver is the usual implementation.
+type Querier interface {
+	Query(ctx context.Context, name string, t RecordType) ([]Record, error)
+}
+
+// A Bridge is a unicast DNS server that answers queries for .local names by
+// asking the link via mDNS, for the benefit of hosts that cannot multicast.
+// The link is given half a second to answer, and answers are cached for as
+// long as their TTLs allow. Queries for any name outside .local, or in any
+// class but IN, are refused.
+type Bridge struct {
+	// Querier is used to ask the link. If nil, DefaultResolver is used.
+	Querier Querier
+
+	mu       sync.Mutex
+	cache    map[bridgeKey]*bridgeEntry
+	inflight map[bridgeKey]*bridgeCall
+}
+
+type bridgeKey struct {
+	name string
+	t    RecordType
+}
+
+type bridgeEntry struct {
+	recs    []Record // records for the name asked about, then any others heard
+	nanswer int      // how many of recs are answers
+	rcode   uint16
+	fetched time.Time
+	expires time.Time
+}
+
+// bridgeCall is a question being asked of the link, which later queries for
+// the same name and type wait on rather than asking again.
+type bridgeCall struct {
+	done chan struct{}
+	e    *bridgeEntry
+}
+
+// ListenAndServe answers DNS queries on addr over both UDP and TCP until ctx
+// is done.
+func (b *Bridge) ListenAndServe(ctx context.Context, addr string) error {
+	pc, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		pc.Close()
+		return err
+	}
+	errs := make(chan error, 2)
+	go func() { errs <- b.ServeUDP(ctx, pc) }()
+	go func() { errs <- b.ServeTCP(ctx, l) }()
+	err = <-errs
+	pc.Close()
+	l.Close()
+	<-errs
+	return err
+}
+
+// ServeUDP answers DNS queries arriving on pc until ctx is done or pc fails.
+// pc is closed on return.
+func (b *Bridge) ServeUDP(ctx context.Context, pc net.PacketConn) error {
+	go func() {
+		<-ctx.Done()
+		pc.Close()
+	}()
+	slots := make(chan struct{}, bridgeUDPWorkers)
+	buf := make([]byte, mDNSMaximumPacketSize)
+	for {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil
+		}
+		n, from, err := pc.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		q := append([]byte(nil), buf[:n]...)
+		go func() {
+			defer func() { <-slots }()
+			resp := b.respond(ctx, q, bridgeUDPSize)
+			if resp != nil {
+				pc.WriteTo(resp, from)
+			}
+		}()
+	}
+}
+
+// ServeTCP answers DNS queries on connections accepted from l until ctx is
+// done or l fails. l is closed on return.
+func (b *Bridge) ServeTCP(ctx context.Context, l net.Listener) error {
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go b.serveConn(ctx, c)
+	}
+}
+
+// serveConn handles length-prefixed queries on c (RFC 1035 sec 4.2.2) one at
+// a time, until the client goes quiet or hangs up.
+func (b *Bridge) serveConn(ctx context.Context, c net.Conn) {
+	defer c.Close()
+	for ctx.Err() == nil {
+		c.SetDeadline(time.Now().Add(30 * time.Second))
+		l, err := readUint16(c)
+		if err != nil {
+			return
+		}
+		q := make([]byte, l)
+		_, err = io.ReadFull(c, q)
+		if err != nil {
+			return
+		}
+		resp := b.respond(ctx, q, 0xffff)
+		if resp == nil {
+			return
+		}
+		_, err = c.Write(append(uint16ToWire(uint16(len(resp))), resp...))
+		if err != nil {
+			return
+		}
+	}
+}
+
+// respond decodes the query in buf and builds the encoded reply, no longer
+// than limit bytes. It returns nil if buf is too mangled to reply to at all.
+func (b *Bridge) respond(ctx context.Context, buf []byte, limit int) []byte {
+	if len(buf) < 12 {
+		return nil
+	}
+	q := &Message{}
+	err := q.Decode(buf, 16)
+
+	m := &Message{
+		ID:    q.ID,
+		Flags: flagResponse | q.Flags&(flagOpcode|flagRecursionDesired),
+	}
+	switch {
+	case err != nil || q.Flags&flagResponse != 0 || len(q.Questions) != 1:
+		m.Flags |= rcodeFormatError
+		return m.Encode()
+	case q.Flags&flagOpcode != 0:
+		m.Flags |= rcodeNotImplemented
+		return m.Encode()
+	}
+	m.Questions = q.Questions
+	qn := &q.Questions[0]
+	qn.Class &^= classCacheFlush
+	if qn.Class != 0x0001 || !isLocalName(qn.Subject.String()) {
+		m.Flags |= rcodeRefused
+		return m.Encode()
+	}
+
+	m.Flags |= flagAuthoritative
+	e := b.lookup(ctx, qn.Subject, qn.Type)
+	m.Flags |= e.rcode
+	age := uint32(time.Since(e.fetched) / time.Second)
+	for i := range e.recs {
+		r := e.recs[i]
+		r.Class &^= classCacheFlush
+		if r.TTL > age {
+			r.TTL -= age
+		} else {
+			r.TTL = 1
+		}
+		if i < e.nanswer {
+			m.Answer = append(m.Answer, r)
+		} else {
+			m.Additional = append(m.Additional, r)
+		}
+	}
+
+	resp := m.Encode()
+	if len(resp) <= limit {
+		return resp
+	}
+	m.Additional = nil
+	for resp = m.Encode(); len(resp) > limit && len(m.Answer) > 0; resp = m.Encode() {
+		m.Flags |= flagTruncated
+		m.Answer = m.Answer[:len(m.Answer)-1]
+	}
+	return resp
+}
+
+// lookup returns the cached entry for s and t, asking the link if there is no
+// live one. Concurrent lookups for the same s and t share one question.
+func (b *Bridge) lookup(ctx context.Context, s *Subject, t RecordType) *bridgeEntry {
+	k := bridgeKey{strings.ToLower(s.String()), t}
+	now := time.Now()
+	b.mu.Lock()
+	if b.cache == nil {
+		b.cache = map[bridgeKey]*bridgeEntry{}
+		b.inflight = map[bridgeKey]*bridgeCall{}
+	}
+	for ck, ce := range b.cache {
+		if now.After(ce.expires) {
+			delete(b.cache, ck)
+		}
+	}
+	e, ok := b.cache[k]
+	if ok {
+		b.mu.Unlock()
+		return e
+	}
+	c, ok := b.inflight[k]
+	if ok {
+		b.mu.Unlock()
+		select {
+		case <-c.done:
+			return c.e
+		case <-ctx.Done():
+			return &bridgeEntry{rcode: rcodeServerFailure, fetched: now}
+		}
+	}
+	c = &bridgeCall{done: make(chan struct{})}
+	b.inflight[k] = c
+	b.mu.Unlock()
+
+	qr := b.Querier
+	if qr == nil {
+		qr = DefaultResolver
+	}
+	qctx, cancel := context.WithTimeout(ctx, bridgeQueryTimeout)
+	recs, err := qr.Query(qctx, s.String(), t)
+	cancel()
+	if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		// the link had its chance to answer
+		err = LookupNotFound
+	}
+	e = bridgeEntryFrom(recs, s, t, now)
+	if e.rcode == rcodeNameError && err != nil && !errors.Is(err, LookupNotFound) {
+		e.rcode = rcodeServerFailure
+	}
+	b.mu.Lock()
+	if ctx.Err() == nil {
+		b.cache[k] = e
+	}
+	delete(b.inflight, k)
+	b.mu.Unlock()
+	c.e = e
+	close(c.done)
+	return e
+}
+
+// bridgeEntryFrom sorts recs into answers for s and t, and everything else.
+// If nothing at all was heard about s the result is NXDOMAIN; if s exists but
+// has no records of type t, it is NODATA (success with no answers).
+func bridgeEntryFrom(recs []Record, s *Subject, t RecordType, now time.Time) *bridgeEntry {
+	e := &bridgeEntry{fetched: now, expires: now.Add(bridgeNegativeTTL), rcode: rcodeNameError}
+	var extra []Record
+	seen := map[string]bool{}
+	var minTTL uint32
+	for _, r := range recs {
+		if r.TTL == 0 {
+			// a goodbye; the record is going away
+			continue
+		}
+		k := recordKey(&r)
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		if !r.Subject.equalFold(s) {
+			extra = append(extra, r)
+			continue
+		}
+		e.rcode = rcodeSuccess
+		if r.Type != t && t != RecordTypeAny && r.Type != RecordTypeCNAME {
+			extra = append(extra, r)
+			continue
+		}
+		e.recs = append(e.recs, r)
+		if minTTL == 0 || r.TTL < minTTL {
+			minTTL = r.TTL
+		}
+	}
+	e.nanswer = len(e.recs)
+	e.recs = append(e.recs, extra...)
+	if minTTL > 0 {
+		e.expires = now.Add(time.Duration(minTTL) * time.Second)
+	}
+	return e
+}
+
+// recordKey identifies a record by its name, type and data, ignoring its TTL
+// and cache-flush bit, so that repeated copies of it can be spotted.
+func recordKey(r *Record) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(r.Subject.String()))
+	b.Write(r.Type.encode())
+	b.Write(uint16ToWire(r.Class &^ classCacheFlush))
+	b.Write(r.Value.encode())
+	return b.String()
+}
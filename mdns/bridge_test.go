@@ -0,0 +1,243 @@
+package mdns_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ironiridis/klonderoo/mdns"
+)
+
+// standIn plays the part of the devices on the link, answering every query
+// with whatever records it holds for the name. Its keys are lowercase.
+type standIn map[string][]mdns.Record
+
+func (s standIn) Query(ctx context.Context, name string, t mdns.RecordType) ([]mdns.Record, error) {
+	recs, ok := s[strings.ToLower(name)]
+	if !ok {
+		return nil, mdns.LookupNotFound
+	}
+	return recs, nil
+}
+
+func mustSubject(t *testing.T, name string) *mdns.Subject {
+	s := &mdns.Subject{}
+	if err := s.FromString(name); err != nil {
+		t.Fatalf("Subject.FromString(%q) returned %+v", name, err)
+	}
+	return s
+}
+
+// dialBridge serves b over UDP until the test ends, and returns a connection
+// to it.
+func dialBridge(t *testing.T, b *mdns.Bridge) net.Conn {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go b.ServeUDP(ctx, pc)
+
+	c, err := net.Dial("udp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestBridge(t *testing.T) {
+	printer := mustSubject(t, "printer.local.")
+	links := standIn{
+		"printer.local.": {{Subject: printer, Type: mdns.RecordTypeA, Class: 0x8001, TTL: 120, Value: &mdns.RecordA{Addr: net.IPv4(192, 168, 1, 20)}}},
+	}
+
+	tab := []struct {
+		name    string
+		t       mdns.RecordType
+		class   uint16
+		rcode   uint16
+		answers int
+	}{
+		{"printer.local.", mdns.RecordTypeA, 1, 0, 1},
+		{"PRINTER.local.", mdns.RecordTypeA, 1, 0, 1},
+		{"printer.local.", mdns.RecordTypeAAAA, 1, 0, 0},
+		{"printer.local.", mdns.RecordTypeA, 3, 5, 0},
+		{"scanner.local.", mdns.RecordTypeA, 1, 3, 0},
+		{"example.com.", mdns.RecordTypeA, 1, 5, 0},
+	}
+	for i, try := range tab {
+		// a Bridge of its own, so that no row leans on what an earlier one cached
+		c := dialBridge(t, &mdns.Bridge{Querier: links})
+		q, err := mdns.NewQuestion(try.name, try.t)
+		if err != nil {
+			t.Fatal(err)
+		}
+		q.Class = try.class
+		q.TransactionID = uint16(i + 1)
+		c.SetDeadline(time.Now().Add(2 * time.Second))
+		_, err = q.WriteTo(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, 512)
+		n, err := c.Read(buf)
+		if err != nil {
+			t.Fatalf("query for %s %s got no reply: %+v", try.name, try.t, err)
+		}
+		m := &mdns.Message{}
+		err = m.Decode(buf[:n], 100)
+		if err != nil {
+			t.Fatalf("reply for %s %s failed to decode: %+v", try.name, try.t, err)
+		}
+		if m.ID != q.TransactionID {
+			t.Errorf("reply for %s %s had ID %d, expected %d", try.name, try.t, m.ID, q.TransactionID)
+		}
+		if m.Flags&0x000f != try.rcode || len(m.Answer) != try.answers {
+			t.Errorf("reply for %s %s class %d had rcode %d and %d answers, expected %d and %d", try.name, try.t, try.class, m.Flags&0x000f, len(m.Answer), try.rcode, try.answers)
+			continue
+		}
+		for _, a := range m.Answer {
+			if a.Class != 0x0001 || a.TTL == 0 || a.TTL > 120 {
+				t.Errorf("reply for %s %s had answer with class %04x and TTL %d", try.name, try.t, a.Class, a.TTL)
+			}
+		}
+	}
+}
+
+// slowStandIn is a standIn that takes its time, and counts the questions asked.
+type slowStandIn struct {
+	standIn
+	asked atomic.Int32
+}
+
+func (s *slowStandIn) Query(ctx context.Context, name string, t mdns.RecordType) ([]mdns.Record, error) {
+	s.asked.Add(1)
+	time.Sleep(200 * time.Millisecond)
+	return s.standIn.Query(ctx, name, t)
+}
+
+func TestBridgeCoalesce(t *testing.T) {
+	printer := mustSubject(t, "printer.local.")
+	links := &slowStandIn{standIn: standIn{
+		"printer.local.": {{Subject: printer, Type: mdns.RecordTypeA, Class: 0x8001, TTL: 120, Value: &mdns.RecordA{Addr: net.IPv4(192, 168, 1, 20)}}},
+	}}
+	c := dialBridge(t, &mdns.Bridge{Querier: links})
+
+	const clients = 10
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			q, err := mdns.NewQuestion(name, mdns.RecordTypeA)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			q.WriteTo(c)
+		}([]string{"printer.local.", "Printer.local."}[i%2])
+	}
+	wg.Wait()
+
+	c.SetDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 512)
+	for i := 0; i < clients; i++ {
+		n, err := c.Read(buf)
+		if err != nil {
+			t.Fatalf("got %d of %d replies: %+v", i, clients, err)
+		}
+		m := &mdns.Message{}
+		if err = m.Decode(buf[:n], 100); err != nil || len(m.Answer) != 1 {
+			t.Errorf("reply %d had %d answers and error %+v", i, len(m.Answer), err)
+		}
+	}
+	if n := links.asked.Load(); n != 1 {
+		t.Errorf("%d concurrent queries for one name asked the link %d times, expected once", clients, n)
+	}
+}
+
+func TestBridgeTCPSplitLength(t *testing.T) {
+	printer := mustSubject(t, "printer.local.")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	addr := serveBridge(t, ctx, standIn{
+		"printer.local.": {{Subject: printer, Type: mdns.RecordTypeA, Class: 0x8001, TTL: 120, Value: &mdns.RecordA{Addr: net.IPv4(192, 168, 1, 20)}}},
+	})
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(2 * time.Second))
+
+	q, err := mdns.NewQuestion("printer.local.", mdns.RecordTypeA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.TransactionID = 7
+	b := q.Encode()
+	// the length prefix arrives a byte at a time
+	c.Write([]byte{byte(len(b) >> 8)})
+	time.Sleep(50 * time.Millisecond)
+	c.Write(append([]byte{byte(len(b))}, b...))
+
+	l := make([]byte, 2)
+	if _, err = io.ReadFull(c, l); err != nil {
+		t.Fatalf("query with a split length prefix got no reply: %+v", err)
+	}
+	buf := make([]byte, int(l[0])<<8|int(l[1]))
+	if _, err = io.ReadFull(c, buf); err != nil {
+		t.Fatalf("reply was cut short: %+v", err)
+	}
+	m := &mdns.Message{}
+	if err = m.Decode(buf, 100); err != nil {
+		t.Fatalf("reply failed to decode: %+v", err)
+	}
+	if m.ID != 7 || len(m.Answer) != 1 {
+		t.Errorf("reply had ID %d and %d answers, expected 7 and 1", m.ID, len(m.Answer))
+	}
+}
+
+// silentStandIn is a link where nobody answers: every query lasts until ctx
+// is done.
+type silentStandIn struct{}
+
+func (silentStandIn) Query(ctx context.Context, name string, t mdns.RecordType) ([]mdns.Record, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestBridgeUnanswered(t *testing.T) {
+	c := dialBridge(t, &mdns.Bridge{Querier: silentStandIn{}})
+	q, err := mdns.NewQuestion("scanner.local.", mdns.RecordTypeA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetDeadline(time.Now().Add(2 * time.Second))
+	start := time.Now()
+	if _, err = q.WriteTo(c); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 512)
+	n, err := c.Read(buf)
+	if err != nil {
+		t.Fatalf("query nobody answers got no reply: %+v", err)
+	}
+	if e := time.Since(start); e > time.Second {
+		t.Errorf("query nobody answers took %v to reply to", e)
+	}
+	m := &mdns.Message{}
+	if err = m.Decode(buf[:n], 100); err != nil {
+		t.Fatalf("reply failed to decode: %+v", err)
+	}
+	if m.Flags&0x000f != 3 {
+		t.Errorf("reply to a query nobody answers had rcode %d, expected 3", m.Flags&0x000f)
+	}
+}
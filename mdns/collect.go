@@ -0,0 +1,93 @@
+package mdns
+
+import (
+	"context"
+	"time"
+)
+
+// Collect runs the Client and gathers every record it hears, in both the
+// answer and additional sections, into one set. A record heard again (the
+// same name, type and data) replaces the earlier copy, so its TTL is the
+// freshest. A goodbye (a record heard with a TTL of zero, RFC 6762 sec 10.1)
+// is not collected, and takes the record it cancels out of the set; should
+// the record be heard again afterwards, it is put back. Collect returns once
+// no new record has arrived for the quiet period (see SetQuietPeriod), or the
+// Client times out. If ctx ends first, the records collected so far are
+// returned along with ctx.Err().
+func (c *Client) Collect(ctx context.Context) ([]Record, error) {
+	ch, err := c.Run()
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	var recs []Record
+	index := map[string]int{}
+	gone := map[int]bool{} // indexes into recs of records said goodbye to
+	live := func() []Record {
+		if len(gone) == 0 {
+			return recs
+		}
+		out := make([]Record, 0, len(recs)-len(gone))
+		for j := range recs {
+			if !gone[j] {
+				out = append(out, recs[j])
+			}
+		}
+		return out
+	}
+	quiet := time.NewTimer(c.quiet)
+	defer quiet.Stop()
+	for {
+		select {
+		case res, ok := <-ch:
+			if !ok {
+				return live(), nil
+			}
+			fresh := false
+			for _, sec := range [][]Record{res.Answer, res.Additional} {
+				for i := range sec {
+					k := recordKey(&sec[i])
+					j, seen := index[k]
+					switch {
+					case sec[i].TTL == 0:
+						if seen {
+							gone[j] = true
+						}
+					case seen:
+						recs[j] = sec[i]
+						if gone[j] {
+							delete(gone, j)
+							fresh = true
+						}
+					default:
+						index[k] = len(recs)
+						recs = append(recs, sec[i])
+						fresh = true
+					}
+				}
+			}
+			if fresh {
+				// without Go 1.23's timers, a tick already sent must be
+				// drained, or it would end the quiet period at once
+				if !quiet.Stop() {
+					select {
+					case <-quiet.C:
+					default:
+					}
+				}
+				quiet.Reset(c.quiet)
+			}
+		case <-quiet.C:
+			return live(), nil
+		case <-ctx.Done():
+			return live(), ctx.Err()
+		}
+	}
+}
+
+// SetQuietPeriod changes how long Collect waits for new records before
+// returning from the default of 1 second.
+func (c *Client) SetQuietPeriod(d time.Duration) {
+	c.quiet = d
+}
@@ -0,0 +1,77 @@
+package mdns_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ironiridis/klonderoo/mdns"
+)
+
+func TestCollect(t *testing.T) {
+	vn := &mdns.VirtualNetwork{}
+	ptr := func(target string) mdns.Record {
+		return mdns.Record{
+			Subject: mustSubject(t, "_printer._tcp.local."),
+			Type:    mdns.RecordTypePTR,
+			Class:   0x0001,
+			TTL:     4500,
+			Value:   &mdns.RecordPTR{Name: *mustSubject(t, target)},
+		}
+	}
+	// both hosts hold the first record, so it is heard at least twice
+	for _, targets := range [][]string{
+		{"Office._printer._tcp.local."},
+		{"Office._printer._tcp.local.", "Lab._printer._tcp.local."},
+	} {
+		rs, err := mdns.NewResponderTransport(vn, nil)
+		if err != nil {
+			t.Fatalf("NewResponderTransport returned %+v", err)
+		}
+		defer rs.Close()
+		for _, target := range targets {
+			rs.Publish(ptr(target))
+		}
+	}
+
+	c, err := mdns.NewClient("_printer._tcp.local.", mdns.RecordTypePTR)
+	if err != nil {
+		t.Fatalf("NewClient returned %+v", err)
+	}
+	c.SetTransport(vn)
+	c.SetQuietPeriod(300 * time.Millisecond)
+
+	// a third host comes and goes while the Client listens, and says goodbye
+	// to a record nobody heard
+	other, err := vn.Listen(nil, mdns.DefaultSocketOptions())
+	if err != nil {
+		t.Fatalf("VirtualNetwork.Listen returned %+v", err)
+	}
+	defer other.Close()
+	attic, cellar := ptr("Attic._printer._tcp.local."), ptr("Cellar._printer._tcp.local.")
+	hello := &mdns.Message{Flags: 0x8400, Answer: []mdns.Record{attic}}
+	attic.TTL, cellar.TTL = 0, 0
+	bye := &mdns.Message{Flags: 0x8400, Answer: []mdns.Record{attic, cellar}}
+	go func() {
+		for _, m := range []*mdns.Message{hello, bye} {
+			time.Sleep(50 * time.Millisecond)
+			other.WriteTo(m.Encode(), &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353})
+		}
+	}()
+	start := time.Now()
+	recs, err := c.Collect(context.Background())
+	if err != nil {
+		t.Fatalf("Client.Collect returned %+v", err)
+	}
+	if time.Since(start) > 3*time.Second {
+		t.Errorf("Client.Collect took %v to notice the quiet", time.Since(start))
+	}
+	got := map[string]int{}
+	for _, r := range recs {
+		got[r.Value.String()]++
+	}
+	if len(recs) != 2 || got["Office._printer._tcp.local."] != 1 || got["Lab._printer._tcp.local."] != 1 {
+		t.Errorf("Client.Collect returned %d records: %v", len(recs), got)
+	}
+}
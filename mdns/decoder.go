@@ -0,0 +1,135 @@
+package mdns
+
+import "io"
+
+// decoder reads a DNS message straight out of the packet buffer. It keeps
+// only an offset into buf, so decoding costs no allocations beyond whatever
+// the decoded values need to hold on to. A record parser is handed a decoder
+// whose buf ends with the record's data, which keeps it from reading past
+// it, while names can still follow compression pointers anywhere earlier.
+type decoder struct {
+	buf   []byte
+	off   int
+	rdata bool // buf ends with a record's data rather than the packet
+}
+
+func (d *decoder) uint16() (uint16, error) {
+	if len(d.buf)-d.off < 2 {
+		return 0, d.short()
+	}
+	v := wireToUint16(d.buf[d.off:])
+	d.off += 2
+	return v, nil
+}
+
+func (d *decoder) uint32() (uint32, error) {
+	if len(d.buf)-d.off < 4 {
+		return 0, d.short()
+	}
+	v := wireToUint32(d.buf[d.off:])
+	d.off += 4
+	return v, nil
+}
+
+// countOverflow returns the offset of the count in the header hdr at which the
+// counts from hdr[first] on add up to more than max, or -1 if they never do.
+func countOverflow(hdr *[6]uint16, first, max int) int64 {
+	n := 0
+	for i := first; i < len(hdr); i++ {
+		n += int(hdr[i])
+		if n > max {
+			return int64(i * 2)
+		}
+	}
+	return -1
+}
+
+// next returns the following n bytes of buf. The slice aliases the packet, so
+// it must be copied if kept.
+func (d *decoder) next(n int) ([]byte, error) {
+	if len(d.buf)-d.off < n {
+		return nil, d.short()
+	}
+	b := d.buf[d.off : d.off+n]
+	d.off += n
+	return b, nil
+}
+
+// short is the error for running out of data: the end of the packet, or of
+// the record's data for a decoder made by bounded.
+func (d *decoder) short() error {
+	if d.rdata {
+		return RecordDataOverrun
+	}
+	return io.ErrUnexpectedEOF
+}
+
+// bounded returns a decoder for the n bytes following the current offset,
+// which can still see everything before them.
+func (d *decoder) bounded(n int) (decoder, error) {
+	if len(d.buf)-d.off < n {
+		return decoder{}, io.ErrUnexpectedEOF
+	}
+	return decoder{buf: d.buf[:d.off+n], off: d.off, rdata: true}, nil
+}
+
+// name decodes a name into s, reusing its storage. Compression pointers are
+// followed only backwards, and only so many times, so that a malicious packet
+// cannot send us round in circles.
+func (d *decoder) name(s *Subject) error {
+	s.s = s.s[:0]
+	err := d.labels(s)
+	if err != nil {
+		s.s = nil
+	}
+	return err
+}
+
+func (d *decoder) labels(s *Subject) error {
+	p := d.off
+	jumped := false
+	for hops := 0; ; {
+		if p >= len(d.buf) {
+			return d.short()
+		}
+		l := int(d.buf[p])
+		if l&0xc0 == 0xc0 {
+			// label compression
+			if p+1 >= len(d.buf) {
+				return d.short()
+			}
+			o := (l&0x3f)<<8 | int(d.buf[p+1])
+			if !jumped {
+				d.off = p + 2
+				jumped = true
+			}
+			if hops >= maxPointerHops {
+				return CompressionPointerLoop
+			}
+			if o >= p {
+				// RFC 1035 sec 4.1.4 only allows pointing at a prior occurrence
+				return CompressionPointerForward
+			}
+			hops++
+			p = o
+			continue
+		}
+		if l > 63 {
+			return IllegalHostnameLabelTooLong
+		}
+		if len(s.s)+1+l > maxNameLength {
+			return IllegalHostnameTooLong
+		}
+		if p+1+l > len(d.buf) {
+			return d.short()
+		}
+		s.s = append(s.s, d.buf[p:p+1+l]...)
+		p += 1 + l
+		if l == 0 {
+			if !jumped {
+				d.off = p
+			}
+			return nil
+		}
+	}
+}
@@ -1,5 +1,10 @@
 package mdns
 
+import (
+	"fmt"
+	"net"
+)
+
 // Error represents an mDNS client error
 type Error string
 
@@ -9,6 +14,10 @@ func (e Error) Error() string { return string(e) }
 const (
 	IllegalHostnameLabelTooLong  = Error("hostname contains an illegal label component that is more than 63 bytes")
 	IllegalHostnameLabelEmpty    = Error("hostname contains an illegal label component that is empty")
+	IllegalHostnameTooLong       = Error("hostname is longer than 255 bytes")
+	CompressionPointerForward    = Error("name compression pointer does not point backwards")
+	CompressionPointerLoop       = Error("name follows too many compression pointers")
+	RecordDataOverrun            = Error("record parser tried to read past the end of its data")
 	CannotDecodeRecordType       = Error("unable to decode this record type")
 	ResponseReservedBitsHigh     = Error("reserved zero bits not zero")
 	ResponseFlagMissing          = Error("decoded header missing response bit")
@@ -24,4 +33,54 @@ const (
 	ResponseTooLarge             = Error("decoded header advertised more records than permitted")
 	RecordParseTypeUnsupported   = Error("cannot parse record due to unsupported type")
 	RecordParseLengthUnexpected  = Error("record type has a canonical length but packet disagrees")
+	LookupNotFound               = Error("no mDNS responder answered for this name")
+	ReflectorTooFewInterfaces    = Error("a reflector needs at least two interfaces")
+	ResponderClosed              = Error("responder has been closed")
+	ServiceAlreadyRegistered     = Error("service is already registered with this responder")
+	ServiceNotRegistered         = Error("service is not registered with this responder")
+	ServiceHostUnknown           = Error("service has no host and the responder has no host name")
+	HostNameConflict             = Error("host name and every alternative tried are in use by other hosts")
+	StrictModeUnsupported        = Error("strict mode is not supported on this platform")
+	PacketNotTrusted             = Error("packet failed the checks of strict mode")
+	RecordTypeUnknown            = Error("record type name is not known")
+	ZoneSyntax                   = Error("zone file line is malformed")
+	TextStringTooLong            = Error("TXT record string is longer than 255 bytes")
 )
+
+// A DecodeError describes a part of a packet that could not be decoded.
+type DecodeError struct {
+	Offset  int64      // where in the packet the part that failed begins
+	Section string     // "header", "question", "answer", "authority" or "additional"
+	Index   int        // which question or record in Section failed
+	Name    string     // the record's name, if it got that far
+	Type    RecordType // the record's type, if it got that far
+	Err     error
+}
+
+func (e *DecodeError) Error() string {
+	if e.Section == "header" {
+		return fmt.Sprintf("offset %d: header: %v", e.Offset, e.Err)
+	}
+	if e.Name == "" {
+		return fmt.Sprintf("offset %d: %s %d: %v", e.Offset, e.Section, e.Index, e.Err)
+	}
+	return fmt.Sprintf("offset %d: %s %d (%s %s): %v", e.Offset, e.Section, e.Index, e.Name, e.Type, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *DecodeError) Unwrap() error { return e.Err }
+
+// A PacketError reports a received packet that was dropped, along with the
+// packet itself so that it can be logged or saved for later study.
+type PacketError struct {
+	Source net.Addr
+	Packet []byte
+	Err    error // often a *DecodeError
+}
+
+func (e *PacketError) Error() string {
+	return fmt.Sprintf("packet from %v dropped: %v", e.Source, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *PacketError) Unwrap() error { return e.Err }
@@ -0,0 +1,60 @@
+package mdns
+
+import "testing"
+
+func FuzzResultDecode(f *testing.F) {
+	q, _ := NewQuestion("_googlecast._tcp.local.", RecordTypePTR)
+	f.Add(q.Encode())
+	f.Add([]byte{
+		0x00, 0x00, 0x84, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00,
+		0x01, 'a', 0x05, 'l', 'o', 'c', 'a', 'l', 0x00,
+		0x00, 0x0c, 0x00, 0x01, 0x00, 0x00, 0x00, 0x78, 0x00, 0x02,
+		0xc0, 0x0c,
+	})
+	// a name whose pointer points at itself
+	f.Add([]byte{
+		0x00, 0x00, 0x84, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00,
+		0xc0, 0x0c, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00, 0x00, 0x78, 0x00, 0x04,
+		10, 0, 0, 1,
+	})
+
+	f.Fuzz(func(t *testing.T, pkt []byte) {
+		r := &Result{maxrecs: 1000}
+		if r.decode(pkt) == nil {
+			for _, sec := range [][]Record{r.Answer, r.Additional} {
+				for i := range sec {
+					if len(sec[i].Subject.Encode()) > maxNameLength {
+						t.Errorf("decoded name is %d bytes long", len(sec[i].Subject.Encode()))
+					}
+					_ = sec[i].Subject.String()
+					_ = sec[i].Value.String()
+				}
+			}
+		}
+
+		m := &Message{}
+		if m.Decode(pkt, 1000) == nil {
+			// whatever we could decode, we should be able to encode and
+			// decode again
+			m2 := &Message{}
+			err := m2.Decode(m.Encode(), 1000)
+			if err != nil {
+				t.Errorf("re-decoding an encoded Message failed: %+v", err)
+			}
+		}
+	})
+}
+
+func TestDecodeTooLarge(t *testing.T) {
+	// one answer, and more additional records than allowed
+	pkt := []byte{0x00, 0x00, 0x84, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x10}
+	r := &Result{maxrecs: 10}
+	rerr := r.decode(pkt)
+	merr := (&Message{}).Decode(pkt, 10)
+	for _, err := range []error{rerr, merr} {
+		de, ok := err.(*DecodeError)
+		if !ok || de.Err != ResponseTooLarge || de.Offset != 10 {
+			t.Errorf("decoding returned %+v, expected ResponseTooLarge at the ARCOUNT, offset 10", err)
+		}
+	}
+}
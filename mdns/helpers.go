@@ -4,7 +4,8 @@ import "io"
 
 // Because of message compression (RFC1035 sec 4.1.4) we need to be able to
 // read not just the packet as it arrives, but also random unknown offsets in
-// the DNS packet. Therefore we need io.ReaderAt.
+// the DNS packet. Therefore we need io.ReaderAt. Whole packets are decoded
+// from memory by a decoder instead; this is only for Subject.ReadFrom.
 type mDNSPacketReader interface {
 	io.Reader
 	io.ReaderAt
@@ -34,20 +35,19 @@ func wireToUint16(x []byte) uint16 {
 	return uint16(x[0])<<8 | uint16(x[1])
 }
 
+// readUint16 reads a big-endian uint16 from r, which may deliver it a byte at
+// a time, as a stream can.
 func readUint16(r io.Reader) (uint16, error) {
 	b := make([]byte, 2)
-	n, err := r.Read(b)
+	_, err := io.ReadFull(r, b)
 	if err != nil {
 		return 0, err
 	}
-	if n < 2 {
-		return 0, io.ErrUnexpectedEOF
-	}
 	return wireToUint16(b), nil
 }
 
 func uint32ToWire(x uint32) []byte {
-	return []byte{byte(x >> 8), byte(x & 0xff)}
+	return []byte{byte(x >> 24), byte(x >> 16), byte(x >> 8), byte(x & 0xff)}
 }
 
 func wireToUint32(x []byte) uint32 {
@@ -56,15 +56,3 @@ func wireToUint32(x []byte) uint32 {
 	}
 	return uint32(x[0])<<24 | uint32(x[1])<<16 | uint32(x[2])<<8 | uint32(x[3])
 }
-
-func readUint32(r io.Reader) (uint32, error) {
-	b := make([]byte, 4)
-	n, err := r.Read(b)
-	if err != nil {
-		return 0, err
-	}
-	if n < 4 {
-		return 0, io.ErrUnexpectedEOF
-	}
-	return wireToUint32(b), nil
-}
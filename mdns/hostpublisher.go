@@ -0,0 +1,328 @@
+package mdns
+
+import (
+	"net"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// hostSettle is how long a HostPublisher waits after hearing of an address
+// change before acting on it, since changes tend to arrive in bursts.
+const hostSettle = 500 * time.Millisecond
+
+// hostProbeTries bounds how many times a HostPublisher probes for a name
+// before giving up, whether the names tried conflicted or it deferred to
+// another host.
+const hostProbeTries = 15
+
+// A HostPublisher claims "<hostname>.local." for this machine, publishing the
+// addresses of each interface as A and AAAA records (along with their reverse
+// PTR records) through a Responder on that interface, so that a query is
+// answered with addresses reachable from where it came. As addresses come and
+// go, the changed records are announced or withdrawn.
+//
+// The name is first probed for (RFC 6762 sec 8.1). If another host already
+// answers for it, "-2", "-3" and so on are tried in turn (sec 9), and Name
+// reports the one claimed.
+//
+// Services registered through the HostPublisher, or through one of its
+// Responders, that have no Host of their own point at the published name.
+type HostPublisher struct {
+	name  string
+	links []*hostLink
+
+	mu     sync.Mutex
+	closed bool
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+type hostLink struct {
+	ifc  *net.Interface
+	rs   *Responder
+	recs []Record
+}
+
+// NewHostPublisher starts publishing name, which should end in ".local.". If
+// name is empty, the OS host name (up to its first dot) is used. If no
+// interfaces are given, every interface that is up, not a loopback, and
+// capable of multicast is used. It returns once a name has been claimed.
+func NewHostPublisher(name string, ifcs ...*net.Interface) (*HostPublisher, error) {
+	return NewHostPublisherTransport(UDPTransport{}, name, ifcs...)
+}
+
+// NewHostPublisherTransport is NewHostPublisher, running its Responders
+// through t.
+func NewHostPublisherTransport(t Transport, name string, ifcs ...*net.Interface) (*HostPublisher, error) {
+	if name == "" {
+		h, err := os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+		h, _, _ = strings.Cut(h, ".")
+		name = h + ".local."
+	}
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	if err := (&Subject{}).FromString(name); err != nil {
+		return nil, err
+	}
+
+	if len(ifcs) == 0 {
+		all, err := net.Interfaces()
+		if err != nil {
+			return nil, err
+		}
+		for i := range all {
+			f := all[i].Flags
+			if f&net.FlagUp != 0 && f&net.FlagMulticast != 0 && f&net.FlagLoopback == 0 {
+				ifcs = append(ifcs, &all[i])
+			}
+		}
+	}
+
+	hp := &HostPublisher{name: name, done: make(chan struct{})}
+	for _, ifc := range ifcs {
+		rs, err := NewResponderTransport(t, ifc)
+		if err != nil {
+			hp.Close()
+			return nil, err
+		}
+		hp.links = append(hp.links, &hostLink{ifc: ifc, rs: rs})
+	}
+	if err := hp.claim(); err != nil {
+		hp.Close()
+		return nil, err
+	}
+	hp.sync()
+
+	changed := make(chan struct{}, 1)
+	hp.wg.Add(2)
+	go func() {
+		defer hp.wg.Done()
+		watchAddrs(hp.done, func() {
+			select {
+			case changed <- struct{}{}:
+			default:
+			}
+		})
+	}()
+	go func() {
+		defer hp.wg.Done()
+		for {
+			select {
+			case <-hp.done:
+				return
+			case <-changed:
+			}
+			select {
+			case <-hp.done:
+				return
+			case <-time.After(hostSettle):
+			}
+			hp.sync()
+		}
+	}()
+	return hp, nil
+}
+
+// Name returns the host name being published, such as "myhost.local.".
+func (hp *HostPublisher) Name() string {
+	return hp.name
+}
+
+// Responders returns the Responder running on each interface.
+func (hp *HostPublisher) Responders() []*Responder {
+	rss := make([]*Responder, len(hp.links))
+	for i, l := range hp.links {
+		rss[i] = l.rs
+	}
+	return rss
+}
+
+// Register publishes s on every interface.
+func (hp *HostPublisher) Register(s *Service) error {
+	for i, l := range hp.links {
+		err := l.rs.Register(s)
+		if err != nil {
+			for _, u := range hp.links[:i] {
+				u.rs.Unregister(s)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Unregister withdraws s from every interface.
+func (hp *HostPublisher) Unregister(s *Service) error {
+	var first error
+	for _, l := range hp.links {
+		err := l.rs.Unregister(s)
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Close stops watching for address changes and closes every Responder,
+// sending goodbyes for the host's records and any registered services.
+func (hp *HostPublisher) Close() error {
+	hp.mu.Lock()
+	if hp.closed {
+		hp.mu.Unlock()
+		return nil
+	}
+	hp.closed = true
+	close(hp.done)
+	hp.mu.Unlock()
+
+	hp.wg.Wait()
+	for _, l := range hp.links {
+		l.rs.Close()
+	}
+	return nil
+}
+
+// claim probes for the host name on every interface, renaming it whenever
+// another host turns out to hold it, until one is found that is free.
+func (hp *HostPublisher) claim() error {
+	base, n := hp.name, 1
+	for tries := 0; tries < hostProbeTries; tries++ {
+		switch hp.probe() {
+		case probeClaimed:
+			for _, l := range hp.links {
+				l.rs.SetHostName(hp.name)
+			}
+			return nil
+		case probeConflict:
+			n++
+			hp.name = altName(base, n)
+		case probeDeferred:
+			// another host wants the same name; give it the chance to claim
+			// it before probing again (RFC 6762 sec 8.2)
+			time.Sleep(time.Second)
+		}
+	}
+	return HostNameConflict
+}
+
+// probe probes for the host name on every interface at once, proposing the
+// address records each would publish.
+func (hp *HostPublisher) probe() probeResult {
+	host := &Subject{}
+	if host.FromString(hp.name) != nil {
+		return probeConflict
+	}
+	results := make(chan probeResult, len(hp.links))
+	for _, l := range hp.links {
+		var recs []Record
+		for _, r := range hp.addrRecords(l.ifc) {
+			if r.Subject.equalFold(host) {
+				recs = append(recs, r)
+			}
+		}
+		go func(rs *Responder) { results <- rs.probe(host, recs) }(l.rs)
+	}
+	res := probeClaimed
+	for range hp.links {
+		if r := <-results; r > res {
+			res = r
+		}
+	}
+	return res
+}
+
+// altName returns the n'th alternative to name, numbering its first label:
+// "myhost-2.local." for "myhost.local.".
+func altName(name string, n int) string {
+	first, rest, _ := strings.Cut(name, ".")
+	suffix := "-" + strconv.Itoa(n)
+	if len(first)+len(suffix) > 63 {
+		first = first[:63-len(suffix)]
+	}
+	return first + suffix + "." + rest
+}
+
+// sync brings the records published on each interface into line with the
+// addresses it currently has.
+func (hp *HostPublisher) sync() {
+	hp.mu.Lock()
+	defer hp.mu.Unlock()
+	if hp.closed {
+		return
+	}
+	for _, l := range hp.links {
+		want := hp.addrRecords(l.ifc)
+		var gone, fresh []Record
+		for i := range l.recs {
+			if !containsRecord(want, &l.recs[i]) {
+				gone = append(gone, l.recs[i])
+			}
+		}
+		for i := range want {
+			if !containsRecord(l.recs, &want[i]) {
+				fresh = append(fresh, want[i])
+			}
+		}
+		l.rs.Withdraw(gone...)
+		l.rs.Publish(fresh...)
+		l.recs = want
+	}
+}
+
+// hostAddrs returns the current addresses of ifc, or none if it is down. It
+// is a variable so that tests can stand in for the OS.
+var hostAddrs = func(ifc *net.Interface) []net.Addr {
+	// the interface's flags and addresses may have changed since we were given it
+	if cur, err := net.InterfaceByIndex(ifc.Index); err == nil {
+		ifc = cur
+	}
+	if ifc.Flags&net.FlagUp == 0 {
+		return nil
+	}
+	addrs, err := ifc.Addrs()
+	if err != nil {
+		return nil
+	}
+	return addrs
+}
+
+// addrRecords builds the address and reverse records for the current
+// addresses of ifc.
+func (hp *HostPublisher) addrRecords(ifc *net.Interface) []Record {
+	addrs := hostAddrs(ifc)
+	host := &Subject{}
+	host.FromString(hp.name)
+	var recs []Record
+	for _, a := range addrs {
+		n, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		ip, ok := netip.AddrFromSlice(n.IP)
+		if !ok {
+			continue
+		}
+		ip = ip.Unmap()
+		r := Record{Subject: host, Class: classCacheFlush | 1, TTL: hostRecordTTL}
+		if ip.Is4() {
+			r.Type, r.Value = RecordTypeA, &RecordA{Addr: net.IP(ip.AsSlice())}
+		} else {
+			r.Type, r.Value = RecordTypeAAAA, &RecordAAAA{Addr: net.IP(ip.AsSlice())}
+		}
+		rev := &Subject{}
+		if rev.FromString(ReverseName(ip)) != nil {
+			continue
+		}
+		recs = append(recs, r, Record{Subject: rev, Type: RecordTypePTR, Class: classCacheFlush | 1,
+			TTL: hostRecordTTL, Value: &RecordPTR{Name: *host}})
+	}
+	return recs
+}
@@ -0,0 +1,198 @@
+package mdns
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeAddrs stands in for the OS as the source of interface addresses.
+type fakeAddrs struct {
+	mu    sync.Mutex
+	addrs []net.Addr
+}
+
+func (f *fakeAddrs) set(ips ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.addrs = nil
+	for _, ip := range ips {
+		f.addrs = append(f.addrs, &net.IPNet{IP: net.ParseIP(ip), Mask: net.CIDRMask(24, 32)})
+	}
+}
+
+func (f *fakeAddrs) get(*net.Interface) []net.Addr {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.addrs
+}
+
+// useFakeAddrs has HostPublishers take their addresses from the returned
+// fakeAddrs until the test ends.
+func useFakeAddrs(t *testing.T, ips ...string) *fakeAddrs {
+	f := &fakeAddrs{}
+	f.set(ips...)
+	orig := hostAddrs
+	hostAddrs = f.get
+	t.Cleanup(func() { hostAddrs = orig })
+	return f
+}
+
+var virtualIfc = &net.Interface{Index: 9100, Name: "virtual0", Flags: net.FlagUp | net.FlagMulticast}
+
+func lookupAll(t *testing.T, vn *VirtualNetwork, name string) []netip.Addr {
+	r := &Resolver{Transport: vn, Timeout: 300 * time.Millisecond}
+	addrs, err := r.LookupIP(context.Background(), name)
+	if err != nil {
+		t.Fatalf("Resolver.LookupIP(%q) returned %+v", name, err)
+	}
+	return addrs
+}
+
+func TestHostPublisher(t *testing.T) {
+	f := useFakeAddrs(t, "10.0.0.40")
+	vn := &VirtualNetwork{}
+	obs, err := vn.Listen(nil, DefaultSocketOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer obs.Close()
+
+	hp, err := NewHostPublisherTransport(vn, "box.local.", virtualIfc)
+	if err != nil {
+		t.Fatalf("NewHostPublisherTransport returned %+v", err)
+	}
+	defer hp.Close()
+	if hp.Name() != "box.local." {
+		t.Errorf("HostPublisher claimed %s, expected box.local.", hp.Name())
+	}
+	if addrs := lookupAll(t, vn, "box.local."); len(addrs) != 1 || addrs[0] != netip.MustParseAddr("10.0.0.40") {
+		t.Errorf("box.local. resolved to %v, expected 10.0.0.40", addrs)
+	}
+
+	// the probes went first, carrying the proposed record
+	m := nextMessage(t, obs)
+	if m.Flags&flagResponse != 0 || len(m.Questions) != 1 || len(m.Authority) != 1 || m.Questions[0].Type != RecordTypeAny {
+		t.Errorf("first message was not a probe: %+v", m)
+	}
+
+	f.set("10.0.0.41")
+	drain(obs)
+	hp.sync()
+	if addrs := lookupAll(t, vn, "box.local."); len(addrs) != 1 || addrs[0] != netip.MustParseAddr("10.0.0.41") {
+		t.Errorf("after an address change, box.local. resolved to %v, expected 10.0.0.41", addrs)
+	}
+	if !heardGoodbye(t, obs, "10.0.0.40") {
+		t.Errorf("no goodbye was heard for the old address")
+	}
+
+	drain(obs)
+	hp.Close()
+	if !heardGoodbye(t, obs, "10.0.0.41") {
+		t.Errorf("no goodbye was heard for the address on Close")
+	}
+}
+
+func TestHostPublisherConflict(t *testing.T) {
+	useFakeAddrs(t, "10.0.0.40")
+	vn := &VirtualNetwork{}
+
+	// another host already answers for the name, and another for its first
+	// alternative
+	for _, name := range []string{"box.local.", "box-2.local."} {
+		rs, err := NewResponderTransport(vn, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rs.Close()
+		s := &Subject{}
+		s.FromString(name)
+		rs.Publish(Record{Subject: s, Type: RecordTypeA, Class: 0x8001, TTL: 120, Value: &RecordA{Addr: net.IPv4(10, 0, 0, 99)}})
+	}
+
+	hp, err := NewHostPublisherTransport(vn, "box.local.", virtualIfc)
+	if err != nil {
+		t.Fatalf("NewHostPublisherTransport returned %+v", err)
+	}
+	defer hp.Close()
+	if hp.Name() != "box-3.local." {
+		t.Errorf("HostPublisher claimed %s, expected box-3.local.", hp.Name())
+	}
+	if addrs := lookupAll(t, vn, "box-3.local."); len(addrs) != 1 || addrs[0] != netip.MustParseAddr("10.0.0.40") {
+		t.Errorf("box-3.local. resolved to %v, expected 10.0.0.40", addrs)
+	}
+}
+
+func TestCompareProbe(t *testing.T) {
+	s := &Subject{}
+	s.FromString("box.local.")
+	a := func(ip string) Record {
+		return Record{Subject: s, Type: RecordTypeA, Class: 0x8001, TTL: 120, Value: &RecordA{Addr: net.ParseIP(ip)}}
+	}
+	tab := []struct {
+		a, b []Record
+		want int
+	}{
+		{[]Record{a("10.0.0.1")}, []Record{a("10.0.0.1")}, 0},
+		{[]Record{a("10.0.0.1")}, []Record{a("10.0.0.2")}, -1},
+		{[]Record{a("10.0.0.9"), a("10.0.0.1")}, []Record{a("10.0.0.1"), a("10.0.0.2")}, 1},
+		{[]Record{a("10.0.0.1")}, []Record{a("10.0.0.1"), a("10.0.0.2")}, -1},
+		{nil, nil, 0},
+	}
+	for _, try := range tab {
+		c := compareProbe(try.a, try.b)
+		if (c < 0 && try.want >= 0) || (c > 0 && try.want <= 0) || (c == 0 && try.want != 0) {
+			t.Errorf("compareProbe(%v, %v) = %d, expected the sign of %d", try.a, try.b, c, try.want)
+		}
+	}
+}
+
+// nextMessage decodes the next packet c hears.
+func nextMessage(t *testing.T, c PacketConn) *Message {
+	buf := make([]byte, mDNSMaximumPacketSize)
+	c.SetDeadline(time.Now().Add(time.Second))
+	n, _, _, err := c.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("heard nothing: %+v", err)
+	}
+	m := &Message{}
+	if err = m.Decode(buf[:n], 100); err != nil {
+		t.Fatalf("message failed to decode: %+v", err)
+	}
+	return m
+}
+
+// drain discards whatever c has heard so far.
+func drain(c PacketConn) {
+	buf := make([]byte, mDNSMaximumPacketSize)
+	for {
+		c.SetDeadline(time.Now().Add(10 * time.Millisecond))
+		if _, _, _, err := c.ReadFrom(buf); err != nil {
+			return
+		}
+	}
+}
+
+// heardGoodbye reports whether c hears an A record for ip with a TTL of zero.
+func heardGoodbye(t *testing.T, c PacketConn, ip string) bool {
+	buf := make([]byte, mDNSMaximumPacketSize)
+	c.SetDeadline(time.Now().Add(500 * time.Millisecond))
+	for {
+		n, _, _, err := c.ReadFrom(buf)
+		if err != nil {
+			return false
+		}
+		m := &Message{}
+		if m.Decode(buf[:n], 100) != nil {
+			continue
+		}
+		for _, r := range m.Answer {
+			if a, ok := r.Value.(*RecordA); ok && r.TTL == 0 && a.Addr.Equal(net.ParseIP(ip)) {
+				return true
+			}
+		}
+	}
+}
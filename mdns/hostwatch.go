@@ -0,0 +1,21 @@
+package mdns
+
+import "time"
+
+// hostPollInterval is how often addresses are re-read where the OS offers no
+// way to be told of changes.
+const hostPollInterval = 30 * time.Second
+
+// pollAddrs calls changed every hostPollInterval until done is closed.
+func pollAddrs(done <-chan struct{}, changed func()) {
+	t := time.NewTicker(hostPollInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-t.C:
+			changed()
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package mdns
+
+import (
+	"syscall"
+	"time"
+)
+
+// Multicast groups of the netlink route protocol, from linux/rtnetlink.h,
+// which the syscall package does not define.
+const (
+	rtmgrpLink       = 0x1
+	rtmgrpIPv4IfAddr = 0x10
+	rtmgrpIPv6IfAddr = 0x100
+)
+
+// watchAddrs calls changed whenever the kernel reports an interface address
+// being added or removed, until done is closed. It listens on a netlink route
+// socket; the messages themselves are not decoded, since the caller re-reads
+// the addresses anyway. If the socket cannot be opened, it falls back to
+// polling.
+func watchAddrs(done <-chan struct{}, changed func()) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_ROUTE)
+	if err != nil {
+		pollAddrs(done, changed)
+		return
+	}
+	defer syscall.Close(fd)
+	err = syscall.Bind(fd, &syscall.SockaddrNetlink{
+		Family: syscall.AF_NETLINK,
+		Groups: rtmgrpIPv4IfAddr | rtmgrpIPv6IfAddr | rtmgrpLink,
+	})
+	if err != nil {
+		pollAddrs(done, changed)
+		return
+	}
+	// wake up now and then to notice done being closed
+	tv := syscall.NsecToTimeval(int64(time.Second))
+	syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv)
+
+	buf := make([]byte, 8192)
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		n, _, err := syscall.Recvfrom(fd, buf, 0)
+		if err == syscall.EAGAIN || err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			pollAddrs(done, changed)
+			return
+		}
+		if n > 0 {
+			changed()
+		}
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package mdns
+
+// watchAddrs calls changed periodically until done is closed, since there is
+// no portable way to be told when interface addresses change.
+func watchAddrs(done <-chan struct{}, changed func()) {
+	pollAddrs(done, changed)
+}
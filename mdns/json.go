@@ -0,0 +1,295 @@
+package mdns
+
+import (
+	"encoding/json"
+	"net"
+	"unicode/utf8"
+)
+
+// Records are rendered in JSON as objects holding the name, type, TTL and
+// class (less the cache-flush bit, which is given separately), with the data
+// under "data" in a form that depends on the type. Names are written as
+// presentName writes them. The data of undecoded records is given in base64.
+
+type recordJSON struct {
+	Name       string          `json:"name"`
+	Type       RecordType      `json:"type"`
+	Class      uint16          `json:"class"`
+	CacheFlush bool            `json:"cacheFlush,omitempty"`
+	TTL        uint32          `json:"ttl"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// MarshalJSON encodes the record as JSON. It has a value receiver, so that a
+// Record is encoded the same way alone, in a slice or in a map.
+func (d Record) MarshalJSON() ([]byte, error) {
+	j := recordJSON{
+		Name:       presentName(d.Subject),
+		Type:       d.Type,
+		Class:      d.Class &^ classCacheFlush,
+		CacheFlush: d.Class&classCacheFlush != 0,
+		TTL:        d.TTL,
+		Data:       json.RawMessage("null"),
+	}
+	if d.Value != nil {
+		data, err := json.Marshal(d.Value)
+		if err != nil {
+			return nil, err
+		}
+		j.Data = data
+	}
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON decodes a record from JSON. Data given in base64 (under
+// "raw") is kept undecoded whatever the type.
+func (d *Record) UnmarshalJSON(b []byte) error {
+	var j recordJSON
+	err := json.Unmarshal(b, &j)
+	if err != nil {
+		return err
+	}
+	s := &Subject{}
+	err = s.fromPresentation(j.Name)
+	if err != nil {
+		return err
+	}
+	d.Subject, d.Type, d.TTL = s, j.Type, j.TTL
+	d.Class = j.Class
+	if j.CacheFlush {
+		d.Class |= classCacheFlush
+	}
+
+	var probe struct {
+		Raw *string `json:"raw"`
+	}
+	err = json.Unmarshal(j.Data, &probe)
+	if err != nil {
+		return err
+	}
+	if probe.Raw != nil {
+		d.Value = &RecordUndecoded{}
+	} else {
+		d.Value = d.Type.parser()
+	}
+	return json.Unmarshal(j.Data, d.Value)
+}
+
+// MarshalText renders the type's name, as zone files do.
+func (t RecordType) MarshalText() ([]byte, error) {
+	return []byte(t.zoneString()), nil
+}
+
+// UnmarshalText parses a type's name, as ParseRecordType does.
+func (t *RecordType) UnmarshalText(b []byte) error {
+	v, err := ParseRecordType(string(b))
+	if err != nil {
+		return err
+	}
+	*t = v
+	return nil
+}
+
+// MarshalText renders the name as a zone file does.
+func (s Subject) MarshalText() ([]byte, error) {
+	return []byte(presentName(&s)), nil
+}
+
+// UnmarshalText parses a name as written by MarshalText.
+func (s *Subject) UnmarshalText(b []byte) error {
+	return s.fromPresentation(string(b))
+}
+
+// MarshalJSON encodes the record as {"addr": "192.0.2.1"}.
+func (a *RecordA) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Addr net.IP `json:"addr"`
+	}{a.Addr})
+}
+
+// UnmarshalJSON decodes the record from JSON.
+func (a *RecordA) UnmarshalJSON(b []byte) error {
+	var j struct {
+		Addr net.IP `json:"addr"`
+	}
+	err := json.Unmarshal(b, &j)
+	a.Addr = j.Addr
+	return err
+}
+
+// MarshalJSON encodes the record as {"addr": "2001:db8::1"}.
+func (a *RecordAAAA) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Addr net.IP `json:"addr"`
+	}{a.Addr})
+}
+
+// UnmarshalJSON decodes the record from JSON.
+func (a *RecordAAAA) UnmarshalJSON(b []byte) error {
+	var j struct {
+		Addr net.IP `json:"addr"`
+	}
+	err := json.Unmarshal(b, &j)
+	a.Addr = j.Addr
+	return err
+}
+
+// MarshalJSON encodes the record as {"name": "..."}.
+func (ptr *RecordPTR) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Name Subject `json:"name"`
+	}{ptr.Name})
+}
+
+// UnmarshalJSON decodes the record from JSON.
+func (ptr *RecordPTR) UnmarshalJSON(b []byte) error {
+	var j struct {
+		Name Subject `json:"name"`
+	}
+	err := json.Unmarshal(b, &j)
+	ptr.Name = j.Name
+	return err
+}
+
+// MarshalJSON encodes the record as {"canonicalName": "..."}.
+func (cnm *RecordCNAME) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		CanonicalName Subject `json:"canonicalName"`
+	}{cnm.CanonicalName})
+}
+
+// UnmarshalJSON decodes the record from JSON.
+func (cnm *RecordCNAME) UnmarshalJSON(b []byte) error {
+	var j struct {
+		CanonicalName Subject `json:"canonicalName"`
+	}
+	err := json.Unmarshal(b, &j)
+	cnm.CanonicalName = j.CanonicalName
+	return err
+}
+
+type srvJSON struct {
+	Priority uint16  `json:"priority"`
+	Weight   uint16  `json:"weight"`
+	Port     uint16  `json:"port"`
+	Target   Subject `json:"target"`
+}
+
+// MarshalJSON encodes the record as JSON.
+func (srv *RecordSRV) MarshalJSON() ([]byte, error) {
+	return json.Marshal(srvJSON(*srv))
+}
+
+// UnmarshalJSON decodes the record from JSON.
+func (srv *RecordSRV) UnmarshalJSON(b []byte) error {
+	var j srvJSON
+	err := json.Unmarshal(b, &j)
+	*srv = RecordSRV(j)
+	return err
+}
+
+// MarshalJSON encodes the record as {"strings": [...]}, split as Strings
+// splits it. Since JSON strings hold only UTF-8, a record holding anything
+// else is encoded whole in base64 instead, as {"base64": "..."}.
+func (txt *RecordTXT) MarshalJSON() ([]byte, error) {
+	ss := txt.Strings()
+	for _, s := range ss {
+		if !utf8.ValidString(s) {
+			return json.Marshal(struct {
+				Base64 []byte `json:"base64"`
+			}{[]byte(txt.Text)})
+		}
+	}
+	if ss == nil {
+		ss = []string{}
+	}
+	return json.Marshal(struct {
+		Strings []string `json:"strings"`
+	}{ss})
+}
+
+// UnmarshalJSON decodes the record from JSON.
+func (txt *RecordTXT) UnmarshalJSON(b []byte) error {
+	var j struct {
+		Strings []string `json:"strings"`
+		Base64  []byte   `json:"base64"`
+	}
+	err := json.Unmarshal(b, &j)
+	if err != nil {
+		return err
+	}
+	if j.Base64 != nil {
+		txt.Text = string(j.Base64)
+		return nil
+	}
+	for _, s := range j.Strings {
+		if len(s) > 255 {
+			return TextStringTooLong
+		}
+	}
+	txt.Text = encodeTXT(j.Strings)
+	return nil
+}
+
+// MarshalJSON encodes the record's data in base64, as {"raw": "..."}.
+func (und *RecordUndecoded) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Raw []byte `json:"raw"`
+	}{und.buf})
+}
+
+// UnmarshalJSON decodes the record from JSON.
+func (und *RecordUndecoded) UnmarshalJSON(b []byte) error {
+	var j struct {
+		Raw []byte `json:"raw"`
+	}
+	err := json.Unmarshal(b, &j)
+	und.buf = j.Raw
+	return err
+}
+
+type decodeErrorJSON struct {
+	Offset  int64      `json:"offset"`
+	Section string     `json:"section"`
+	Index   int        `json:"index"`
+	Name    string     `json:"name,omitempty"`
+	Type    RecordType `json:"type,omitempty"`
+	Error   string     `json:"error"`
+}
+
+type resultJSON struct {
+	Answer     []Record          `json:"answer"`
+	Additional []Record          `json:"additional"`
+	Warnings   []decodeErrorJSON `json:"warnings,omitempty"`
+}
+
+// MarshalJSON encodes the Result as JSON, giving each warning's error as
+// text.
+func (d *Result) MarshalJSON() ([]byte, error) {
+	j := resultJSON{Answer: d.Answer, Additional: d.Additional}
+	if j.Answer == nil {
+		j.Answer = []Record{}
+	}
+	if j.Additional == nil {
+		j.Additional = []Record{}
+	}
+	for _, w := range d.Warnings {
+		j.Warnings = append(j.Warnings, decodeErrorJSON{w.Offset, w.Section, w.Index, w.Name, w.Type, w.Err.Error()})
+	}
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON decodes a Result from JSON. The errors of its warnings become
+// plain Errors holding their text.
+func (d *Result) UnmarshalJSON(b []byte) error {
+	var j resultJSON
+	err := json.Unmarshal(b, &j)
+	if err != nil {
+		return err
+	}
+	d.Answer, d.Additional, d.Warnings = j.Answer, j.Additional, nil
+	for _, w := range j.Warnings {
+		d.Warnings = append(d.Warnings, &DecodeError{w.Offset, w.Section, w.Index, w.Name, w.Type, Error(w.Error)})
+	}
+	return nil
+}
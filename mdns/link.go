@@ -0,0 +1,56 @@
+package mdns
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// linkRefresh is how long the networks of an interface are trusted before
+// being read from the OS again.
+const linkRefresh = 10 * time.Second
+
+// linkNets remembers the networks attached to an interface, so that the
+// source address of a packet can be checked against them cheaply. If ifc is
+// nil, the networks of every interface are used.
+type linkNets struct {
+	ifc     *net.Interface
+	mu      sync.Mutex
+	nets    []*net.IPNet
+	fetched time.Time
+}
+
+func (l *linkNets) refresh() {
+	var addrs []net.Addr
+	var err error
+	if l.ifc != nil {
+		addrs, err = l.ifc.Addrs()
+	} else {
+		addrs, err = net.InterfaceAddrs()
+	}
+	if err != nil {
+		return
+	}
+	l.nets = l.nets[:0]
+	for _, a := range addrs {
+		if n, ok := a.(*net.IPNet); ok {
+			l.nets = append(l.nets, n)
+		}
+	}
+	l.fetched = time.Now()
+}
+
+// contains reports whether ip is on one of the interface's networks.
+func (l *linkNets) contains(ip net.IP) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if time.Since(l.fetched) > linkRefresh {
+		l.refresh()
+	}
+	for _, n := range l.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,351 @@
+package mdns
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// lookupLinger is how long a lookup keeps listening after the first useful
+// answer arrives, so that other responders (or the other address family) have
+// a chance to be heard before we return.
+const lookupLinger = 250 * time.Millisecond
+
+// A Resolver looks up .local names via mDNS. Its methods mirror those of
+// net.Resolver so it can stand in for one where only .local names matter. The
+// zero value is ready to use.
+type Resolver struct {
+	// Interface is the network interface queries are sent on. If nil, the
+	// operating system chooses one.
+	Interface *net.Interface
+
+	// Timeout bounds how long a lookup waits for an answer when ctx has no
+	// earlier deadline. If zero, 5 seconds is used.
+	Timeout time.Duration
+
+	// Server, if set, is the host:port of a unicast DNS server that queries
+	// are sent to instead of being multicast on the link. This allows the
+	// browse and lookup methods to work against wide-area DNS-SD domains
+	// (RFC 6763 sec 11) and discovery proxies (RFC 8766).
+	Server string
+
+	// Domain qualifies service types given to Browse and LookupSRV that have
+	// no domain of their own. If empty, "local." is used.
+	Domain string
+
+	// Strict puts the Clients used for queries into strict mode; see
+	// Client.SetStrict.
+	Strict bool
+
+	// Transport carries the queries. If nil, UDPTransport is used.
+	Transport Transport
+
+	// SocketOptions, if set, replaces DefaultSocketOptions for the Clients
+	// used for queries.
+	SocketOptions *SocketOptions
+}
+
+// DefaultResolver is used by the package-level lookup functions.
+var DefaultResolver = &Resolver{}
+
+// LookupHost looks up host using DefaultResolver.
+func LookupHost(ctx context.Context, host string) ([]string, error) {
+	return DefaultResolver.LookupHost(ctx, host)
+}
+
+// LookupIP looks up host using DefaultResolver.
+func LookupIP(ctx context.Context, host string) ([]netip.Addr, error) {
+	return DefaultResolver.LookupIP(ctx, host)
+}
+
+// DialContext connects to address using DefaultResolver. Its signature
+// matches http.Transport's DialContext field.
+func DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return DefaultResolver.DialContext(ctx, network, address)
+}
+
+func (r *Resolver) timeout(ctx context.Context) time.Duration {
+	t := r.Timeout
+	if t == 0 {
+		t = 5 * time.Second
+	}
+	if dl, ok := ctx.Deadline(); ok && time.Until(dl) < t {
+		t = time.Until(dl)
+	}
+	return t
+}
+
+// answers reports whether recs holds a record of type t (or a CNAME) for s.
+func answers(recs []Record, s *Subject, t RecordType) bool {
+	for i := range recs {
+		if !recs[i].Subject.equalFold(s) {
+			continue
+		}
+		if recs[i].Type == t || recs[i].Type == RecordTypeCNAME {
+			return true
+		}
+	}
+	return false
+}
+
+// Query sends a single mDNS question for name and collects every record from
+// the responses heard until the question is answered (plus lookupLinger), ctx
+// is done, or the timeout passes. If Server is set, the question goes to it
+// instead, and every record in its reply is returned. Records are returned
+// even alongside an error, since responders often volunteer useful records in
+// the additional section.
+func (r *Resolver) Query(ctx context.Context, name string, t RecordType) ([]Record, error) {
+	s := &Subject{}
+	err := s.FromString(name)
+	if err != nil {
+		return nil, err
+	}
+	return r.query(ctx, s, t)
+}
+
+// query is Query for a name already built as a Subject.
+func (r *Resolver) query(ctx context.Context, s *Subject, t RecordType) ([]Record, error) {
+	q := &Question{Subject: s, Type: t, Class: 0x0001}
+	if r.Server != "" {
+		return r.unicastQuery(ctx, q)
+	}
+	c := newClient(q)
+	c.SetInterface(r.Interface)
+	c.SetTimeout(r.timeout(ctx))
+	c.SetStrict(r.Strict)
+	c.SetTransport(r.Transport)
+	if r.SocketOptions != nil {
+		c.SetSocketOptions(*r.SocketOptions)
+	}
+	ch, err := c.Run()
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	var recs []Record
+	var linger <-chan time.Time
+	for {
+		select {
+		case res, ok := <-ch:
+			if !ok {
+				if linger != nil {
+					return recs, nil
+				}
+				return recs, LookupNotFound
+			}
+			recs = append(recs, res.Answer...)
+			recs = append(recs, res.Additional...)
+			if linger == nil && answers(res.Answer, c.q.Subject, t) {
+				linger = time.After(lookupLinger)
+			}
+		case <-linger:
+			return recs, nil
+		case <-ctx.Done():
+			if linger != nil {
+				return recs, nil
+			}
+			return recs, ctx.Err()
+		}
+	}
+}
+
+// addrsFrom picks the addresses for s out of recs, following a CNAME if the
+// responder sent one.
+func addrsFrom(recs []Record, s *Subject) []netip.Addr {
+	names := []*Subject{s}
+	for i := range recs {
+		if cn, ok := recs[i].Value.(*RecordCNAME); ok && recs[i].Subject.equalFold(s) {
+			names = append(names, &cn.CanonicalName)
+		}
+	}
+
+	var addrs []netip.Addr
+	seen := map[netip.Addr]bool{}
+	for i := range recs {
+		var ip net.IP
+		switch v := recs[i].Value.(type) {
+		case *RecordA:
+			ip = v.Addr
+		case *RecordAAAA:
+			ip = v.Addr
+		default:
+			continue
+		}
+		matched := false
+		for _, n := range names {
+			if recs[i].Subject.equalFold(n) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+		a, ok := netip.AddrFromSlice(ip)
+		if !ok {
+			continue
+		}
+		a = a.Unmap()
+		if !seen[a] {
+			seen[a] = true
+			addrs = append(addrs, a)
+		}
+	}
+	return addrs
+}
+
+// LookupIP queries for the A and AAAA records of host and returns the
+// addresses found. Both queries run at once; as soon as either produces an
+// address, the other is given a short grace period before being abandoned.
+func (r *Resolver) LookupIP(ctx context.Context, host string) ([]netip.Addr, error) {
+	s := &Subject{}
+	err := s.FromString(host)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type reply struct {
+		recs []Record
+		err  error
+	}
+	ch := make(chan reply, 2)
+	for _, t := range []RecordType{RecordTypeA, RecordTypeAAAA} {
+		go func(t RecordType) {
+			recs, err := r.Query(ctx, host, t)
+			ch <- reply{recs, err}
+		}(t)
+	}
+
+	var recs []Record
+	var linger <-chan time.Time
+	for pending := 2; pending > 0; {
+		select {
+		case rep := <-ch:
+			pending--
+			recs = append(recs, rep.recs...)
+			if err == nil {
+				err = rep.err
+			}
+			if linger == nil && len(addrsFrom(recs, s)) > 0 {
+				linger = time.After(lookupLinger)
+			}
+		case <-linger:
+			cancel()
+			linger = nil
+		}
+	}
+
+	addrs := addrsFrom(recs, s)
+	if len(addrs) == 0 {
+		if err == nil {
+			err = LookupNotFound
+		}
+		return nil, err
+	}
+	return r.zoned(addrs), nil
+}
+
+// zoned attaches the Resolver's interface as the zone of any IPv6 link-local
+// addresses in addrs, without which they could not be dialed.
+func (r *Resolver) zoned(addrs []netip.Addr) []netip.Addr {
+	if r.Interface == nil {
+		return addrs
+	}
+	for i, a := range addrs {
+		if a.Is6() && a.IsLinkLocalUnicast() && a.Zone() == "" {
+			addrs[i] = a.WithZone(r.Interface.Name)
+		}
+	}
+	return addrs
+}
+
+// LookupHost is like LookupIP, but returns the addresses as strings in the
+// manner of net.LookupHost.
+func (r *Resolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	addrs, err := r.LookupIP(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	s := make([]string, len(addrs))
+	for i := range addrs {
+		s[i] = addrs[i].String()
+	}
+	return s, nil
+}
+
+// isLocalName reports whether host belongs to the .local domain, and should
+// therefore be resolved via mDNS.
+func isLocalName(host string) bool {
+	return inDomain(host, "local")
+}
+
+// inDomain reports whether host is domain or a name beneath it.
+func inDomain(host, domain string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// domain returns the domain the Resolver browses and resolves within.
+func (r *Resolver) domain() string {
+	if r.Domain == "" {
+		return "local."
+	}
+	return r.Domain
+}
+
+// dialAddrs tries each of addrs in turn until a connection succeeds, and
+// returns the first error if none do.
+func dialAddrs(ctx context.Context, network string, addrs []netip.Addr, port string) (net.Conn, error) {
+	var d net.Dialer
+	var first error
+	for _, a := range addrs {
+		switch {
+		case strings.HasSuffix(network, "4") && !a.Is4():
+			continue
+		case strings.HasSuffix(network, "6") && !a.Is6():
+			continue
+		}
+		c, err := d.DialContext(ctx, network, net.JoinHostPort(a.String(), port))
+		if err == nil {
+			return c, nil
+		}
+		if first == nil {
+			first = err
+		}
+	}
+	if first == nil {
+		first = LookupNotFound
+	}
+	return nil, first
+}
+
+// DialContext connects to address on the named network. If the host portion
+// of address is a .local name (or, when Server is set, a name within Domain)
+// it is resolved with LookupIP and each address is tried in turn; otherwise
+// dialing is handed to a net.Dialer unchanged.
+func (r *Resolver) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	mine := isLocalName(host)
+	if r.Server != "" {
+		mine = inDomain(host, r.domain())
+	}
+	if !mine {
+		var d net.Dialer
+		return d.DialContext(ctx, network, address)
+	}
+	addrs, err := r.LookupIP(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	return dialAddrs(ctx, network, addrs, port)
+}
@@ -0,0 +1,83 @@
+package mdns_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ironiridis/klonderoo/mdns"
+)
+
+func TestResolverLookupHost(t *testing.T) {
+	vn := &mdns.VirtualNetwork{}
+	rs := virtualHost(t, vn, "nas.local.", net.IPv4(10, 0, 0, 20))
+	err := rs.Publish(mdns.Record{
+		Subject: mustSubject(t, "nas.local."),
+		Type:    mdns.RecordTypeAAAA,
+		Class:   0x8001,
+		TTL:     120,
+		Value:   &mdns.RecordAAAA{Addr: net.ParseIP("fd00::20")},
+	})
+	if err != nil {
+		t.Fatalf("Responder.Publish returned %+v", err)
+	}
+
+	r := &mdns.Resolver{Transport: vn, Timeout: time.Second}
+	hosts, err := r.LookupHost(context.Background(), "nas.local.")
+	if err != nil {
+		t.Fatalf("Resolver.LookupHost returned %+v", err)
+	}
+	found := map[string]bool{}
+	for _, h := range hosts {
+		found[h] = true
+	}
+	if len(hosts) != 2 || !found["10.0.0.20"] || !found["fd00::20"] {
+		t.Errorf("Resolver.LookupHost returned %v", hosts)
+	}
+
+	if _, err := r.LookupHost(context.Background(), "cellar.local."); err == nil {
+		t.Errorf("Resolver.LookupHost of a name nobody has succeeded")
+	}
+}
+
+func TestResolverDialContext(t *testing.T) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen returned %+v", err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			c.Write([]byte("hello"))
+			c.Close()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+
+	vn := &mdns.VirtualNetwork{}
+	virtualHost(t, vn, "printer.local.", net.IPv4(127, 0, 0, 1))
+	r := &mdns.Resolver{Transport: vn, Timeout: time.Second}
+
+	for _, addr := range []string{"printer.local.:" + port, "127.0.0.1:" + port} {
+		c, err := r.DialContext(context.Background(), "tcp", addr)
+		if err != nil {
+			t.Errorf("Resolver.DialContext(%q) returned %+v", addr, err)
+			continue
+		}
+		buf := make([]byte, 5)
+		n, _ := c.Read(buf)
+		c.Close()
+		if string(buf[:n]) != "hello" {
+			t.Errorf("dialing %q read %q", addr, buf[:n])
+		}
+	}
+
+	if _, err := r.DialContext(context.Background(), "tcp6", "printer.local.:"+port); err == nil {
+		t.Errorf("dialing tcp6 to a host with only an IPv4 address succeeded")
+	}
+}
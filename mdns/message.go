@@ -0,0 +1,146 @@
+package mdns
+
+import (
+	"bytes"
+)
+
+// Header flag bits, as laid out in RFC 1035 sec 4.1.1.
+const (
+	flagResponse           uint16 = 0x8000
+	flagOpcode             uint16 = 0x7800
+	flagAuthoritative      uint16 = 0x0400
+	flagTruncated          uint16 = 0x0200
+	flagRecursionDesired   uint16 = 0x0100
+	flagRecursionAvailable uint16 = 0x0080
+	flagResponseCode       uint16 = 0x000f
+)
+
+// Response codes carried in the low bits of the header flags.
+const (
+	rcodeSuccess        uint16 = 0
+	rcodeFormatError    uint16 = 1
+	rcodeServerFailure  uint16 = 2
+	rcodeNameError      uint16 = 3
+	rcodeNotImplemented uint16 = 4
+	rcodeRefused        uint16 = 5
+)
+
+// classCacheFlush is the top bit of a record's class, which mDNS repurposes
+// as the cache-flush bit (RFC 6762 sec 10.2). In questions the same bit asks
+// for a unicast response (sec 5.4).
+const classCacheFlush uint16 = 0x8000
+
+// Message is a complete DNS message of any kind: a query, a response, or
+// anything in between. Unlike Result, decoding a Message makes no judgement
+// about its flags, so it suits code that needs to handle both directions.
+// Only the Subject, Type and Class of each entry in Questions are used.
+type Message struct {
+	ID         uint16
+	Flags      uint16
+	Questions  []Question
+	Answer     []Record
+	Authority  []Record
+	Additional []Record
+
+	// Warnings lists the records whose data could not be parsed when the
+	// Message was decoded. Such records are kept, holding a RecordUndecoded.
+	Warnings []*DecodeError
+}
+
+// IsResponse reports whether the header flags mark m as a response, rather
+// than a query.
+func (m *Message) IsResponse() bool {
+	return m.Flags&flagResponse != 0
+}
+
+// Encode will render Message in wire format. Names are not compressed.
+func (m *Message) Encode() []byte {
+	var b bytes.Buffer
+	b.Write(uint16ToWire(m.ID))
+	b.Write(uint16ToWire(m.Flags))
+	b.Write(uint16ToWire(uint16(len(m.Questions))))
+	b.Write(uint16ToWire(uint16(len(m.Answer))))
+	b.Write(uint16ToWire(uint16(len(m.Authority))))
+	b.Write(uint16ToWire(uint16(len(m.Additional))))
+	for i := range m.Questions {
+		m.Questions[i].writeEntry(&b)
+	}
+	for _, sec := range [][]Record{m.Answer, m.Authority, m.Additional} {
+		for i := range sec {
+			sec[i].writeTo(&b)
+		}
+	}
+	return b.Bytes()
+}
+
+// Decode will parse buf, which holds a whole DNS message, into Message. No
+// more than maxrecs questions and records in total will be accepted. The
+// storage of any records Message already holds is reused, so records kept
+// from an earlier Decode must be copied out first.
+func (m *Message) Decode(buf []byte, maxrecs int) (err error) {
+	d := &decoder{buf: buf}
+	var hdr [6]uint16
+	for i := range hdr {
+		hdr[i], err = d.uint16()
+		if err != nil {
+			return &DecodeError{Offset: int64(i * 2), Section: "header", Err: err}
+		}
+	}
+	m.ID, m.Flags = hdr[0], hdr[1]
+	if off := countOverflow(&hdr, 2, maxrecs); off >= 0 {
+		return &DecodeError{Offset: off, Section: "header", Err: ResponseTooLarge}
+	}
+
+	m.Questions = make([]Question, hdr[2])
+	for i := range m.Questions {
+		start := int64(d.off)
+		err = m.Questions[i].decode(d)
+		if err != nil {
+			return &DecodeError{Offset: start, Section: "question", Index: i, Err: err}
+		}
+	}
+	m.Warnings = m.Warnings[:0]
+	m.Answer, err = decodeRecords(d, m.Answer, hdr[3], "answer", &m.Warnings)
+	if err != nil {
+		return
+	}
+	m.Authority, err = decodeRecords(d, m.Authority, hdr[4], "authority", &m.Warnings)
+	if err != nil {
+		return
+	}
+	m.Additional, err = decodeRecords(d, m.Additional, hdr[5], "additional", &m.Warnings)
+	return
+}
+
+// decodeRecords decodes n consecutive resource records of the named section
+// from d, into recs' storage where there is room. A record whose data can't
+// be parsed is kept with its data undecoded, and reported in warns; any other
+// failure ends decoding.
+func decodeRecords(d *decoder, recs []Record, n uint16, section string, warns *[]*DecodeError) ([]Record, error) {
+	if n == 0 {
+		return recs[:0], nil
+	}
+	if cap(recs) >= int(n) {
+		recs = recs[:n]
+	} else {
+		recs = append(recs[:cap(recs)], make([]Record, int(n)-cap(recs))...)
+	}
+	for i := range recs {
+		start := int64(d.off)
+		err := recs[i].decode(d)
+		if err == nil {
+			continue
+		}
+		de := &DecodeError{Offset: start, Section: section, Index: i, Err: err}
+		if recs[i].Subject != nil {
+			de.Name, de.Type = recs[i].Subject.String(), recs[i].Type
+		}
+		if re, ok := err.(rdataError); ok {
+			de.Err = re.err
+			*warns = append(*warns, de)
+			continue
+		}
+		return nil, de
+	}
+	return recs, nil
+}
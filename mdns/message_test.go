@@ -0,0 +1,135 @@
+package mdns_test
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ironiridis/klonderoo/mdns"
+)
+
+func TestMessageDecodeWarnings(t *testing.T) {
+	pkt := []byte{
+		0x00, 0x00, 0x84, 0x00, // response, authoritative
+		0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0x00, // two answers
+		// an A record with five bytes of data, which can't be right
+		0x01, 'a', 0x05, 'l', 'o', 'c', 'a', 'l', 0x00,
+		0x00, 0x01, 0x80, 0x01, 0x00, 0x00, 0x00, 0x78, 0x00, 0x05,
+		10, 0, 0, 1, 99,
+		// a sound A record, using a compression pointer to the first name
+		0xc0, 0x0c,
+		0x00, 0x01, 0x80, 0x01, 0x00, 0x00, 0x00, 0x78, 0x00, 0x04,
+		10, 0, 0, 2,
+	}
+	m := &mdns.Message{}
+	err := m.Decode(pkt, 10)
+	if err != nil {
+		t.Fatalf("Message.Decode returned %+v", err)
+	}
+	if len(m.Answer) != 2 {
+		t.Fatalf("Message.Decode returned %d answers, expected 2", len(m.Answer))
+	}
+	if und, ok := m.Answer[0].Value.(*mdns.RecordUndecoded); !ok || und.Len() != 5 {
+		t.Errorf("first answer should be undecoded with 5 bytes, but was %#v", m.Answer[0].Value)
+	}
+	if a, ok := m.Answer[1].Value.(*mdns.RecordA); !ok || a.String() != "10.0.0.2" {
+		t.Errorf("second answer should be A 10.0.0.2, but was %#v", m.Answer[1].Value)
+	}
+	if len(m.Warnings) != 1 {
+		t.Fatalf("Message.Decode returned %d warnings, expected 1", len(m.Warnings))
+	}
+	w := m.Warnings[0]
+	if w.Offset != 12 || w.Section != "answer" || w.Index != 0 || w.Name != "a.local." || !errors.Is(w, mdns.RecordParseLengthUnexpected) {
+		t.Errorf("warning was %q", w)
+	}
+
+	err = m.Decode(pkt[:40], 10)
+	var de *mdns.DecodeError
+	if !errors.As(err, &de) || de.Section != "answer" || de.Index != 1 {
+		t.Errorf("Message.Decode of a truncated packet returned %+v", err)
+	}
+}
+
+// castResponse builds a response like the i'th Chromecast on a network sends,
+// with the name compression a real responder uses. Its names, addresses and
+// TXT record vary with i.
+func castResponse(i int) []byte {
+	ptr := func(off int) []byte { return []byte{0xc0 | byte(off>>8), byte(off)} }
+	label := func(s string) []byte { return append([]byte{byte(len(s))}, s...) }
+	rr := func(b []byte, t, class uint16, ttl uint32, rdata []byte) []byte {
+		b = append(b, byte(t>>8), byte(t), byte(class>>8), byte(class))
+		b = append(b, byte(ttl>>24), byte(ttl>>16), byte(ttl>>8), byte(ttl))
+		b = append(b, byte(len(rdata)>>8), byte(len(rdata)))
+		return append(b, rdata...)
+	}
+
+	b := []byte{0x00, 0x00, 0x84, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x03}
+	svc := len(b)
+	b = append(b, label("_googlecast")...)
+	b = append(b, label("_tcp")...)
+	local := len(b)
+	b = append(b, label("local")...)
+	b = append(b, 0)
+	inst := len(b) + 10
+	id := fmt.Sprintf("%016x", uint64(i)*0x9e3779b97f4a7c15)
+	b = rr(b, 0x000c, 0x0001, 4500, append(label("Chromecast-"+id), ptr(svc)...))
+
+	b = append(b, ptr(inst)...)
+	host := len(b) + 10 + 6
+	b = rr(b, 0x0021, 0x8001, 120, append([]byte{0, 0, 0, 0, 0x1f, 0x49}, append(label(id[:8]+"-"+id[8:12]+"-"+id[12:]), ptr(local)...)...))
+
+	var txt []byte
+	rooms := []string{"Living Room", "Kitchen", "Bedroom", "Office speaker group", "Den"}
+	for _, t := range []string{"id=" + id + id, "cd=" + strings.ToUpper(id), "rm=", "ve=05", "md=Chromecast", "ic=/setup/icon.png", "fn=" + rooms[i%len(rooms)], "ca=199172", "st=" + strconv.Itoa(i%2), "bs=FA8FCA" + id[:6], "nf=1", "rs="} {
+		txt = append(txt, label(t)...)
+	}
+	b = append(b, ptr(inst)...)
+	b = rr(b, 0x0010, 0x8001, 4500, txt)
+
+	b = append(b, ptr(host)...)
+	b = rr(b, 0x0001, 0x8001, 120, []byte{192, 168, byte(i >> 8), byte(i)})
+	return b
+}
+
+// TestMessageDecodeAllocs pins what BenchmarkMessageDecode measures: decoding
+// into a Message that has decoded before costs a single allocation, against 94
+// before records were decoded in place.
+func TestMessageDecodeAllocs(t *testing.T) {
+	pkts := make([][]byte, 64)
+	m := &mdns.Message{}
+	for i := range pkts {
+		pkts[i] = castResponse(i)
+		m.Decode(pkts[i], 100)
+	}
+	i := 0
+	allocs := testing.AllocsPerRun(len(pkts)*4, func() {
+		m.Decode(pkts[i%len(pkts)], 100)
+		i++
+	})
+	if allocs > 1 {
+		t.Errorf("Message.Decode made %v allocations per packet, expected 1", allocs)
+	}
+}
+
+// BenchmarkMessageDecode decodes the responses of a network of Chromecasts in
+// turn, so that no two decodes in a row see the same packet.
+func BenchmarkMessageDecode(b *testing.B) {
+	pkts := make([][]byte, 64)
+	size := 0
+	m := &mdns.Message{}
+	for i := range pkts {
+		pkts[i] = castResponse(i)
+		size += len(pkts[i])
+		if err := m.Decode(pkts[i], 100); err != nil || len(m.Warnings) > 0 {
+			b.Fatalf("castResponse(%d) doesn't decode cleanly: %+v %+v", i, err, m.Warnings)
+		}
+	}
+	b.ReportAllocs()
+	b.SetBytes(int64(size / len(pkts)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Decode(pkts[i%len(pkts)], 100)
+	}
+}
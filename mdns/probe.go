@@ -0,0 +1,155 @@
+package mdns
+
+import (
+	"bytes"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// Probe timing from RFC 6762 sec 8.1: three queries, 250ms apart, after a
+// random delay of up to 250ms.
+const (
+	probeCount    = 3
+	probeInterval = 250 * time.Millisecond
+)
+
+// probeResult is the outcome of probing for a name.
+type probeResult int
+
+// The results are ordered so that, probing on several links at once, the
+// greatest of them holds for the name.
+const (
+	probeClaimed  probeResult = iota // nobody else has the name
+	probeDeferred                    // another host is probing for it too, and won the tie-break
+	probeConflict                    // another host answered for it
+)
+
+// A prober is a name being probed for, and what has been heard about it.
+type prober struct {
+	name   *Subject
+	recs   []Record
+	result chan probeResult // holds the first result other than probeClaimed
+}
+
+// settle records res, unless an earlier result is already held.
+func (p *prober) settle(res probeResult) {
+	select {
+	case p.result <- res:
+	default:
+	}
+}
+
+// probe asks the link whether any other host holds records for name, before
+// recs (which may be empty) are published for it (RFC 6762 sec 8.1).
+func (rs *Responder) probe(name *Subject, recs []Record) probeResult {
+	p := &prober{name: name, recs: recs, result: make(chan probeResult, 1)}
+	rs.mu.Lock()
+	if rs.closed {
+		rs.mu.Unlock()
+		return probeConflict
+	}
+	rs.probes = append(rs.probes, p)
+	rs.mu.Unlock()
+	defer func() {
+		rs.mu.Lock()
+		for i := range rs.probes {
+			if rs.probes[i] == p {
+				rs.probes = append(rs.probes[:i], rs.probes[i+1:]...)
+				break
+			}
+		}
+		rs.mu.Unlock()
+	}()
+
+	wait := time.Duration(rand.Int63n(int64(probeInterval)))
+	for i := 0; i <= probeCount; i++ {
+		select {
+		case res := <-p.result:
+			return res
+		case <-rs.done:
+			return probeConflict
+		case <-time.After(wait):
+		}
+		if i == probeCount {
+			break
+		}
+		q := Question{Subject: name, Type: RecordTypeAny, Class: 1}
+		if i == 0 {
+			// the first probe asks for a unicast reply (sec 8.1)
+			q.Class |= classCacheFlush
+		}
+		rs.send(&Message{Questions: []Question{q}, Authority: recs}, rs.addr)
+		wait = probeInterval
+	}
+	return probeClaimed
+}
+
+// heardResponse checks the response m against the names being probed for. Any
+// record for one of them that isn't exactly one of ours is a conflict.
+func (rs *Responder) heardResponse(m *Message) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	for _, p := range rs.probes {
+		for _, sec := range [][]Record{m.Answer, m.Additional} {
+			for i := range sec {
+				if sec[i].Subject.equalFold(p.name) && !containsRecord(p.recs, &sec[i]) {
+					p.settle(probeConflict)
+				}
+			}
+		}
+	}
+}
+
+// heardProbe checks the query m for another host probing for a name we are
+// probing for too. The host whose proposed records compare greater wins; the
+// other defers (sec 8.2).
+func (rs *Responder) heardProbe(m *Message) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	for _, p := range rs.probes {
+		asked := false
+		for i := range m.Questions {
+			asked = asked || m.Questions[i].Subject.equalFold(p.name)
+		}
+		if !asked {
+			continue
+		}
+		var theirs []Record
+		for i := range m.Authority {
+			if m.Authority[i].Subject.equalFold(p.name) {
+				theirs = append(theirs, m.Authority[i])
+			}
+		}
+		if compareProbe(p.recs, theirs) < 0 {
+			p.settle(probeDeferred)
+		}
+	}
+}
+
+// compareProbe orders two sets of proposed records as sec 8.2 describes: each
+// is sorted by class, type and data, and the first difference decides. If one
+// runs out first, it is the lesser.
+func compareProbe(a, b []Record) int {
+	ka, kb := probeKeys(a), probeKeys(b)
+	for i := 0; i < len(ka) && i < len(kb); i++ {
+		if c := bytes.Compare(ka[i], kb[i]); c != 0 {
+			return c
+		}
+	}
+	return len(ka) - len(kb)
+}
+
+// probeKeys renders recs as their class, type and data, sorted.
+func probeKeys(recs []Record) [][]byte {
+	keys := make([][]byte, len(recs))
+	for i := range recs {
+		var b bytes.Buffer
+		b.Write(uint16ToWire(recs[i].Class &^ classCacheFlush))
+		b.Write(recs[i].Type.encode())
+		b.Write(recs[i].Value.encode())
+		keys[i] = b.Bytes()
+	}
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+	return keys
+}
@@ -1,47 +1,72 @@
 package mdns
 
 import (
-	"bytes"
 	"net"
+	"sync"
 	"time"
 )
 
 const mDNSMaximumPacketSize = 9000 // rfc6762 section 17
 
+// MaximumPacketSize is the largest packet mDNS sends (RFC 6762 sec 17). A buffer
+// of this size holds any packet a PacketConn reads.
+const MaximumPacketSize = mDNSMaximumPacketSize
+
 // Client is the main data type of the package.
 type Client struct {
 	q       *Question
 	addr    *net.UDPAddr
-	conn    *net.UDPConn
+	conn    PacketConn
+	tr      Transport
 	ifc     *net.Interface
 	timeout time.Duration
+	quiet   time.Duration
 	maxrecs int
+	strict  bool
+	link    *linkNets
+	opts    SocketOptions
+	onError func(*PacketError)
 	r       chan<- *Result
+	done    chan struct{}
+	once    sync.Once
 }
 
-func (c *Client) readPacket(buf []byte) {
-	b := bytes.NewReader(buf)
-	r := &Result{maxrecs: c.maxrecs}
-	err := r.readFrom(b)
-	if err != nil {
+// dropped reports a packet that is being thrown away to the error handler.
+func (c *Client) dropped(src *net.UDPAddr, buf []byte, err error) {
+	if c.onError == nil {
 		return
 	}
-	c.r <- r
+	c.onError(&PacketError{Source: src, Packet: append([]byte(nil), buf...), Err: err})
 }
 
-func (c *Client) start() (err error) {
-	c.addr, err = net.ResolveUDPAddr("udp4", "224.0.0.251:5353")
+func (c *Client) readPacket(src *net.UDPAddr, buf []byte) {
+	r := newResult(c.maxrecs)
+	err := r.decode(buf)
 	if err != nil {
+		r.Release()
+		c.dropped(src, buf, err)
 		return
 	}
+	select {
+	case c.r <- r:
+	case <-c.done:
+	}
+}
 
-	c.conn, err = net.ListenMulticastUDP("udp4", c.ifc, c.addr)
+func (c *Client) start() (err error) {
+	opts := c.opts
+	if c.strict {
+		opts.MulticastTTL = 255
+		opts.Strict = true
+		c.link = &linkNets{ifc: c.ifc}
+	}
+	c.conn, err = transportOrDefault(c.tr).Listen(c.ifc, opts)
 	if err != nil {
 		return
 	}
+	c.addr = mDNSGroup
 	c.conn.SetDeadline(time.Now().Add(c.timeout))
-	c.conn.SetReadBuffer(mDNSMaximumPacketSize)
-	_, err = c.conn.WriteToUDP(c.q.Encode(), c.addr)
+	_, err = c.conn.WriteTo(c.q.Encode(), c.addr)
 	if err != nil {
 		c.conn.Close()
 		return
@@ -51,24 +76,49 @@ func (c *Client) start() (err error) {
 		defer c.conn.Close()
 		buf := make([]byte, mDNSMaximumPacketSize)
 		for {
-			n, err := c.conn.Read(buf)
+			n, src, ttl, err := c.conn.ReadFrom(buf)
 			if err != nil {
 				return
 			}
-			c.readPacket(buf[:n])
+			if c.strict && !c.trusted(src, ttl) {
+				c.dropped(src, buf[:n], PacketNotTrusted)
+				continue
+			}
+			c.readPacket(src, buf[:n])
 		}
 	}()
 	return nil
 }
 
+// trusted applies the checks of strict mode to a packet from src: it must
+// have arrived with an IP TTL of 255, meaning it was not routed, and come from
+// an address on the local link (RFC 6762 sec 11).
+func (c *Client) trusted(src *net.UDPAddr, ttl int) bool {
+	if ttl != 255 {
+		return false
+	}
+	return src.IP.IsLinkLocalUnicast() || c.link.contains(src.IP)
+}
+
 // NewClient requests, via mDNS, records for host of type t within timeout
 func NewClient(host string, t RecordType) (*Client, error) {
 	q, err := NewQuestion(host, t)
 	if err != nil {
 		return nil, err
 	}
-	c := &Client{q: q, timeout: 5 * time.Second, maxrecs: 1000}
-	return c, nil
+	return newClient(q), nil
+}
+
+// newClient returns a Client asking q.
+func newClient(q *Question) *Client {
+	return &Client{
+		q:       q,
+		timeout: 5 * time.Second,
+		quiet:   time.Second,
+		maxrecs: 1000,
+		opts:    DefaultSocketOptions(),
+		done:    make(chan struct{}),
+	}
 }
 
 // SetTimeout changes the timeout to a value other than the default of 5 seconds
@@ -82,6 +132,38 @@ func (c *Client) SetMaximumRecords(n int) {
 	c.maxrecs = n
 }
 
+// SetStrict enables or disables strict mode, which is off by default. In
+// strict mode outgoing packets are sent with an IP TTL of 255, and received
+// packets are dropped unless they arrived with a TTL of 255 and from an
+// address on the local link, as RFC 6762 sec 11 describes. This guards
+// against spoofed responses routed in from other networks. Run fails if the
+// platform cannot report received TTLs.
+func (c *Client) SetStrict(strict bool) {
+	c.strict = strict
+}
+
+// SetSocketOptions changes the socket options to something other than those
+// returned by DefaultSocketOptions.
+func (c *Client) SetSocketOptions(o SocketOptions) {
+	c.opts = o
+}
+
+// SetErrorHandler sets a function to be called with each received packet
+// that is dropped, whether because it could not be decoded or because it
+// failed the checks of strict mode. Records that fail to parse within an
+// otherwise sound packet don't cause it to be dropped; they are listed in
+// Result.Warnings instead. f is called from the Client's receiving goroutine,
+// so it should not block.
+func (c *Client) SetErrorHandler(f func(*PacketError)) {
+	c.onError = f
+}
+
+// SetTransport changes the Transport this Client uses from the default of
+// UDPTransport.
+func (c *Client) SetTransport(t Transport) {
+	c.tr = t
+}
+
 // SetInterface changes the network interface this Client will use for mDNS
 func (c *Client) SetInterface(ifc *net.Interface) {
 	c.ifc = ifc
@@ -98,3 +180,15 @@ func (c *Client) Run() (<-chan *Result, error) {
 	}
 	return r, nil
 }
+
+// Close stops a running Client before its timeout expires. The Result chan is
+// closed once the receiving goroutine notices, and any Result not yet read is
+// discarded.
+func (c *Client) Close() {
+	c.once.Do(func() {
+		close(c.done)
+		if c.conn != nil {
+			c.conn.Close()
+		}
+	})
+}
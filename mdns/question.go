@@ -29,11 +29,33 @@ func (q *Question) Encode() []byte {
 	b.Write(uint16ToWire(0)) // answer record count
 	b.Write(uint16ToWire(0)) // authority record count
 	b.Write(uint16ToWire(0)) // additional record count
-	q.Subject.WriteTo(&b)
+	q.writeEntry(&b)
+
+	return b.Bytes()
+}
+
+// writeEntry writes just the question section entry (name, type and class)
+// for q, without any message header.
+func (q *Question) writeEntry(b *bytes.Buffer) {
+	q.Subject.WriteTo(b)
 	b.Write(q.Type.encode())
 	b.Write(uint16ToWire(q.Class))
+}
 
-	return b.Bytes()
+// decode reads a question section entry from d into q.
+func (q *Question) decode(d *decoder) (err error) {
+	q.Subject = &Subject{}
+	err = d.name(q.Subject)
+	if err != nil {
+		return
+	}
+	t, err := d.uint16()
+	if err != nil {
+		return
+	}
+	q.Type = RecordType(t)
+	q.Class, err = d.uint16()
+	return
 }
 
 // NewQuestion takes a subject and a query type and returns an initialized Question
@@ -1,5 +1,7 @@
 package mdns
 
+import "bytes"
+
 // Record is an individual piece of information such as an IP address.
 type Record struct {
 	Subject *Subject
@@ -14,38 +16,74 @@ type Record struct {
 // this package.
 type ParseableRecord interface {
 	String() string
-	parse(mDNSPacketReader, uint16) error
+	parse(decoder, uint16) error
+	encode() []byte
+}
+
+// rdataError is returned by Record.decode when the record's data could not
+// be parsed, but the rest of it could, so that decoding can carry on past it.
+type rdataError struct {
+	err error
 }
 
-// readFrom consumes bytes from r and decodes them, which you could probably guess
-func (d *Record) readFrom(r mDNSPacketReader) (err error) {
-	d.Subject = &Subject{}
-	err = d.Subject.ReadFrom(r)
+func (e rdataError) Error() string { return e.err.Error() }
+
+// decode reads a record from dec, which you could probably guess. Any Subject
+// and Value d already holds are reused where they fit. If only the record
+// data fails to parse, Value holds it undecoded and an rdataError is
+// returned.
+func (d *Record) decode(dec *decoder) (err error) {
+	prev := d.Type
+	d.Type = 0
+	if d.Subject == nil {
+		d.Subject = &Subject{}
+	}
+	err = dec.name(d.Subject)
 	if err != nil {
 		return
 	}
 
-	t, err := readUint16(r)
+	t, err := dec.uint16()
 	if err != nil {
 		return
 	}
-	d.Type = RecordType(t)
-
-	d.Class, err = readUint16(r)
+	d.Class, err = dec.uint16()
 	if err != nil {
 		return
 	}
-
-	d.TTL, err = readUint32(r)
+	d.TTL, err = dec.uint32()
 	if err != nil {
 		return
 	}
-
-	d.length, err = readUint16(r)
+	d.length, err = dec.uint16()
 	if err != nil {
 		return
 	}
-	d.Value = d.Type.parser()
-	d.Value.parse(r, d.length)
-	return
+	rd, err := dec.bounded(int(d.length))
+	if err != nil {
+		return
+	}
+	d.Type = RecordType(t)
+	if d.Value == nil || d.Type != prev || !d.Type.fits(d.Value) {
+		d.Value = d.Type.parser()
+	}
+	dec.off += int(d.length)
+	perr := d.Value.parse(rd, d.length)
+	if perr == nil {
+		return nil
+	}
+	d.Value = &RecordUndecoded{buf: append([]byte(nil), rd.buf[rd.off:]...)}
+	return rdataError{perr}
+}
+
+// writeTo encodes the record in wire format and writes it to b. Names are
+// written uncompressed.
+func (d *Record) writeTo(b *bytes.Buffer) {
+	rdata := d.Value.encode()
+	d.Subject.WriteTo(b)
+	b.Write(d.Type.encode())
+	b.Write(uint16ToWire(d.Class))
+	b.Write(uint32ToWire(d.TTL))
+	b.Write(uint16ToWire(uint16(len(rdata))))
+	b.Write(rdata)
 }
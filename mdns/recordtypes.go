@@ -2,7 +2,6 @@ package mdns
 
 import (
 	"fmt"
-	"io"
 	"net"
 )
 
@@ -43,6 +42,32 @@ func (t RecordType) parser() ParseableRecord {
 	return &RecordUndecoded{}
 }
 
+// fits reports whether v is what parser returns for t, so that it can be
+// reused to decode another record of type t.
+func (t RecordType) fits(v ParseableRecord) bool {
+	switch v.(type) {
+	case *RecordA:
+		return t == RecordTypeA
+	case *RecordCNAME:
+		return t == RecordTypeCNAME
+	case *RecordPTR:
+		return t == RecordTypePTR
+	case *RecordTXT:
+		return t == RecordTypeTXT
+	case *RecordAAAA:
+		return t == RecordTypeAAAA
+	case *RecordSRV:
+		return t == RecordTypeSRV
+	case *RecordUndecoded:
+		switch t {
+		case RecordTypeA, RecordTypeCNAME, RecordTypePTR, RecordTypeTXT, RecordTypeAAAA, RecordTypeSRV:
+			return false
+		}
+		return true
+	}
+	return false
+}
+
 func (t RecordType) String() string {
 	switch t {
 	case RecordTypeA:
@@ -105,89 +130,114 @@ type RecordUndecoded struct {
 func (ptr *RecordPTR) String() string {
 	return ptr.Name.String()
 }
-func (ptr *RecordPTR) parse(r mDNSPacketReader, l uint16) error {
-	return ptr.Name.ReadFrom(r)
+func (ptr *RecordPTR) encode() []byte {
+	return ptr.Name.Encode()
+}
+func (ptr *RecordPTR) parse(r decoder, l uint16) error {
+	return r.name(&ptr.Name)
 }
 func (txt *RecordTXT) String() string {
 	return txt.Text
 }
-func (txt *RecordTXT) parse(r mDNSPacketReader, l uint16) error {
-	b := make([]byte, l)
-	n, err := r.Read(b)
+
+// Strings splits the TXT record into its character strings (RFC 1035 sec
+// 3.3.14). A final string that claims to run past the end of the record is
+// cut short.
+func (txt *RecordTXT) Strings() []string {
+	var ss []string
+	for t := txt.Text; len(t) > 0; {
+		l := int(t[0])
+		t = t[1:]
+		if l > len(t) {
+			l = len(t)
+		}
+		ss = append(ss, t[:l])
+		t = t[l:]
+	}
+	return ss
+}
+func (txt *RecordTXT) encode() []byte {
+	return []byte(txt.Text)
+}
+func (txt *RecordTXT) parse(r decoder, l uint16) error {
+	b, err := r.next(int(l))
 	if err != nil {
 		return err
 	}
-	if n < int(l) {
-		return io.ErrUnexpectedEOF
+	if txt.Text != string(b) {
+		txt.Text = string(b)
 	}
-	txt.Text = string(b[:n])
 	return nil
 }
 func (cnm *RecordCNAME) String() string {
 	return cnm.CanonicalName.String()
 }
-func (cnm *RecordCNAME) parse(r mDNSPacketReader, l uint16) error {
-	return cnm.CanonicalName.ReadFrom(r)
+func (cnm *RecordCNAME) encode() []byte {
+	return cnm.CanonicalName.Encode()
+}
+func (cnm *RecordCNAME) parse(r decoder, l uint16) error {
+	return r.name(&cnm.CanonicalName)
 }
 func (a *RecordA) String() string {
 	return a.Addr.String()
 }
-func (a *RecordA) parse(r mDNSPacketReader, l uint16) error {
+func (a *RecordA) encode() []byte {
+	return a.Addr.To4()
+}
+func (a *RecordA) parse(r decoder, l uint16) error {
 	if l != 4 {
 		return RecordParseLengthUnexpected
 	}
-	b := make([]byte, 4)
-	n, err := r.Read(b)
+	b, err := r.next(4)
 	if err != nil {
 		return err
 	}
-	if n != 4 {
-		return io.ErrUnexpectedEOF
-	}
-	a.Addr = net.IPv4(b[0], b[1], b[2], b[3])
+	// the same form net.IPv4 gives, in whatever storage a.Addr already has
+	a.Addr = append(a.Addr[:0], 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff, b[0], b[1], b[2], b[3])
 	return nil
 }
 func (a *RecordAAAA) String() string {
 	return a.Addr.String()
 }
-func (a *RecordAAAA) parse(r mDNSPacketReader, l uint16) error {
+func (a *RecordAAAA) encode() []byte {
+	return a.Addr.To16()
+}
+func (a *RecordAAAA) parse(r decoder, l uint16) error {
 	if l != 16 {
 		return RecordParseLengthUnexpected
 	}
-	b := make([]byte, 16)
-	n, err := r.Read(b)
+	b, err := r.next(16)
 	if err != nil {
 		return err
 	}
-	if n != 16 {
-		return io.ErrUnexpectedEOF
-	}
-	copy(a.Addr, b)
+	a.Addr = append(a.Addr[:0], b...)
 	return nil
 }
 func (srv *RecordSRV) String() string {
 	return fmt.Sprintf("pri=%d weight=%d port=%d target=%q", srv.Priority, srv.Weight, srv.Port, srv.Target.String())
 }
-func (srv *RecordSRV) parse(r mDNSPacketReader, l uint16) error {
+func (srv *RecordSRV) encode() []byte {
+	b := make([]byte, 0, 6+len(srv.Target.Encode()))
+	b = append(b, uint16ToWire(srv.Priority)...)
+	b = append(b, uint16ToWire(srv.Weight)...)
+	b = append(b, uint16ToWire(srv.Port)...)
+	return append(b, srv.Target.Encode()...)
+}
+func (srv *RecordSRV) parse(r decoder, l uint16) error {
 	var err error
-	srv.Priority, err = readUint16(r)
-	if err != nil {
-		return err
-	}
-	srv.Weight, err = readUint16(r)
+	srv.Priority, err = r.uint16()
 	if err != nil {
 		return err
 	}
-	srv.Port, err = readUint16(r)
+	srv.Weight, err = r.uint16()
 	if err != nil {
 		return err
 	}
-	err = srv.Target.ReadFrom(r)
+	srv.Port, err = r.uint16()
 	if err != nil {
 		return err
 	}
-
-	return nil
+	return r.name(&srv.Target)
 }
 func (und *RecordUndecoded) String() string {
 	return "[unparsed record data]"
@@ -204,14 +254,15 @@ func (und *RecordUndecoded) Len() int {
 	return len(und.buf)
 }
 
-func (und *RecordUndecoded) parse(r mDNSPacketReader, l uint16) error {
-	und.buf = make([]byte, l)
-	n, err := r.Read(und.buf)
+func (und *RecordUndecoded) encode() []byte {
+	return und.buf
+}
+
+func (und *RecordUndecoded) parse(r decoder, l uint16) error {
+	b, err := r.next(int(l))
 	if err != nil {
 		return err
 	}
-	if n < int(l) {
-		return io.ErrUnexpectedEOF
-	}
+	und.buf = append(und.buf[:0], b...)
 	return nil
 }
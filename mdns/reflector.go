@@ -0,0 +1,330 @@
+package mdns
+
+import (
+	"context"
+	"hash/fnv"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// reflectorDedupWindow is how long a Reflector remembers a packet it has
+// already repeated or sent, so that copies of it arriving by another path
+// (including from other reflectors) are not repeated again. It is kept well
+// short of the one second between a responder's repeated announcements (RFC
+// 6762 sec 8.3), which must each get through.
+const reflectorDedupWindow = 100 * time.Millisecond
+
+// A Reflector repeats mDNS queries and responses heard on each of its
+// Interfaces onto all of the others, so that devices on separate network
+// segments can discover one another. Packets are decoded as Messages on the
+// way through, so that filters and rewrites can act on their contents.
+type Reflector struct {
+	// Interfaces are the links to reflect between. At least two are needed.
+	Interfaces []*net.Interface
+
+	// Transport opens a connection on each of Interfaces. If nil,
+	// UDPTransport is used.
+	Transport Transport
+
+	// Allow, if not empty, lists the only service types (such as
+	// "_googlecast._tcp") whose questions and records may be reflected.
+	// Names that are not part of any service, such as host address records,
+	// are always allowed through.
+	Allow []string
+
+	// Deny lists service types whose questions and records are never
+	// reflected. It takes precedence over Allow.
+	Deny []string
+
+	// Rewrite, if set, is called for every record about to be sent from one
+	// interface to another. It may change rec (replacing, rather than
+	// altering, its Subject or Value) or return false to leave the record
+	// out. Address records holding link-local addresses are always left out,
+	// since they mean nothing on another link.
+	Rewrite func(rec *Record, from, to *net.Interface) bool
+
+	mu    sync.Mutex
+	seen  map[uint64]time.Time
+	links []*reflectorLink
+}
+
+type reflectorLink struct {
+	ifc  *net.Interface
+	conn PacketConn
+	nets []*net.IPNet
+}
+
+// Run reflects traffic until ctx is done.
+func (rf *Reflector) Run(ctx context.Context) error {
+	if len(rf.Interfaces) < 2 {
+		return ReflectorTooFewInterfaces
+	}
+	rf.seen = map[uint64]time.Time{}
+	rf.links = nil
+	defer func() {
+		for _, l := range rf.links {
+			l.conn.Close()
+		}
+	}()
+	for _, ifc := range rf.Interfaces {
+		l := &reflectorLink{ifc: ifc}
+		addrs, err := ifc.Addrs()
+		if err != nil {
+			return err
+		}
+		for _, a := range addrs {
+			if n, ok := a.(*net.IPNet); ok {
+				l.nets = append(l.nets, n)
+			}
+		}
+		// our own reflections must not be looped back to us
+		opts := DefaultSocketOptions()
+		opts.Loopback = false
+		l.conn, err = transportOrDefault(rf.Transport).Listen(ifc, opts)
+		if err != nil {
+			return err
+		}
+		rf.links = append(rf.links, l)
+	}
+
+	errs := make(chan error, len(rf.links))
+	for _, l := range rf.links {
+		go func(l *reflectorLink) {
+			buf := make([]byte, mDNSMaximumPacketSize)
+			for {
+				n, src, _, err := l.conn.ReadFrom(buf)
+				if err != nil {
+					errs <- err
+					return
+				}
+				rf.reflect(buf[:n], src, l)
+			}
+		}(l)
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil
+	case err := <-errs:
+		return err
+	}
+}
+
+// on reports whether src is on l. A socket may hear the group on links other
+// than its own; those packets are left to the link they belong to. A link
+// whose addresses are unknown (as on a VirtualNetwork) takes what it hears.
+func (l *reflectorLink) on(src net.IP) bool {
+	if len(l.nets) == 0 {
+		return true
+	}
+	for _, n := range l.nets {
+		if n.Contains(src) {
+			return true
+		}
+	}
+	return false
+}
+
+// ours reports whether src is one of our own addresses.
+func (rf *Reflector) ours(src net.IP) bool {
+	for _, l := range rf.links {
+		for _, n := range l.nets {
+			if n.IP.Equal(src) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// duplicate reports whether pkt has been reflected or sent recently, and
+// notes it if it has not.
+func (rf *Reflector) duplicate(pkt []byte) bool {
+	k := packetHash(pkt)
+	now := time.Now()
+
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if t, ok := rf.seen[k]; ok && now.Sub(t) < reflectorDedupWindow {
+		return true
+	}
+	rf.noteLocked(k, now)
+	return false
+}
+
+// sent notes pkt as sent, so that it is not repeated back should another
+// reflector return it.
+func (rf *Reflector) sent(pkt []byte) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	rf.noteLocked(packetHash(pkt), time.Now())
+}
+
+// noteLocked records k as seen at now. rf.mu must be held.
+func (rf *Reflector) noteLocked(k uint64, now time.Time) {
+	rf.seen[k] = now
+	if len(rf.seen) > 1024 {
+		for k, t := range rf.seen {
+			if now.Sub(t) >= reflectorDedupWindow {
+				delete(rf.seen, k)
+			}
+		}
+	}
+}
+
+func packetHash(pkt []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(pkt)
+	return h.Sum64()
+}
+
+// reflect repeats pkt, heard from src on the link from, onto the others.
+func (rf *Reflector) reflect(pkt []byte, src *net.UDPAddr, from *reflectorLink) {
+	if src.Port != 5353 {
+		// a legacy unicast query (RFC 6762 sec 6.7); its answer could never
+		// find its way back across the reflector
+		return
+	}
+	if !from.on(src.IP) || rf.ours(src.IP) || rf.duplicate(pkt) {
+		return
+	}
+
+	m := &Message{}
+	err := m.Decode(pkt, 1000)
+	if err != nil {
+		return
+	}
+	changed := rf.filter(m)
+	if len(m.Questions)+len(m.Answer)+len(m.Authority)+len(m.Additional) == 0 {
+		return
+	}
+	for i := range m.Questions {
+		if m.Questions[i].Class&classCacheFlush != 0 {
+			// a unicast reply would go to a host that can't hear it
+			m.Questions[i].Class &^= classCacheFlush
+			changed = true
+		}
+	}
+
+	for _, to := range rf.links {
+		if to == from {
+			continue
+		}
+		out := &Message{ID: m.ID, Flags: m.Flags, Questions: m.Questions}
+		rw := false
+		out.Answer, rw = rf.rewrite(m.Answer, from, to, rw)
+		out.Authority, rw = rf.rewrite(m.Authority, from, to, rw)
+		out.Additional, rw = rf.rewrite(m.Additional, from, to, rw)
+		if !changed && !rw {
+			to.conn.WriteTo(pkt, mDNSGroup)
+			continue
+		}
+		if len(out.Questions)+len(out.Answer)+len(out.Authority)+len(out.Additional) == 0 {
+			continue
+		}
+		b := out.Encode()
+		rf.sent(b)
+		to.conn.WriteTo(b, mDNSGroup)
+	}
+}
+
+// filter removes the questions and records that Allow and Deny forbid from m,
+// and reports whether it removed any.
+func (rf *Reflector) filter(m *Message) bool {
+	if len(rf.Allow) == 0 && len(rf.Deny) == 0 {
+		return false
+	}
+	changed := false
+	qs := m.Questions[:0]
+	for _, q := range m.Questions {
+		if rf.permitted(q.Subject) {
+			qs = append(qs, q)
+		} else {
+			changed = true
+		}
+	}
+	m.Questions = qs
+	for _, sec := range []*[]Record{&m.Answer, &m.Authority, &m.Additional} {
+		recs := (*sec)[:0]
+		for _, r := range *sec {
+			ok := rf.permitted(r.Subject)
+			if ptr, isPTR := r.Value.(*RecordPTR); ok && isPTR {
+				ok = rf.permitted(&ptr.Name)
+			}
+			if ok {
+				recs = append(recs, r)
+			} else {
+				changed = true
+			}
+		}
+		*sec = recs
+	}
+	return changed
+}
+
+// permitted applies Allow and Deny to the service type that name is part of.
+func (rf *Reflector) permitted(name *Subject) bool {
+	st := serviceTypeOf(name.String())
+	if st == "" || st == "_dns-sd._udp" {
+		return true
+	}
+	for _, d := range rf.Deny {
+		if serviceTypeOf(d) == st {
+			return false
+		}
+	}
+	if len(rf.Allow) == 0 {
+		return true
+	}
+	for _, a := range rf.Allow {
+		if serviceTypeOf(a) == st {
+			return true
+		}
+	}
+	return false
+}
+
+// serviceTypeOf extracts the "_service._proto" pair from a DNS-SD name such
+// as "Living Room._googlecast._tcp.local.", or returns "" if name has none.
+func serviceTypeOf(name string) string {
+	lbls := strings.Split(strings.ToLower(strings.TrimSuffix(name, ".")), ".")
+	for i := 1; i < len(lbls); i++ {
+		if (lbls[i] == "_tcp" || lbls[i] == "_udp") && strings.HasPrefix(lbls[i-1], "_") {
+			return lbls[i-1] + "." + lbls[i]
+		}
+	}
+	return ""
+}
+
+// rewrite prepares recs for sending from one link to another, and reports
+// (or'd into changed) whether the result differs from recs.
+func (rf *Reflector) rewrite(recs []Record, from, to *reflectorLink, changed bool) ([]Record, bool) {
+	out := make([]Record, 0, len(recs))
+	for _, r := range recs {
+		var ip net.IP
+		switch v := r.Value.(type) {
+		case *RecordA:
+			ip = v.Addr
+		case *RecordAAAA:
+			ip = v.Addr
+		}
+		if ip != nil && ip.IsLinkLocalUnicast() {
+			changed = true
+			continue
+		}
+		if rf.Rewrite != nil {
+			orig := r
+			if !rf.Rewrite(&r, from.ifc, to.ifc) {
+				changed = true
+				continue
+			}
+			if r != orig {
+				changed = true
+			}
+		}
+		out = append(out, r)
+	}
+	return out, changed
+}
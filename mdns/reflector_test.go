@@ -0,0 +1,181 @@
+package mdns_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ironiridis/klonderoo/mdns"
+)
+
+// segments is a Transport giving each interface, by index, a VirtualNetwork of
+// its own, as though each were a separate link.
+type segments map[int]*mdns.VirtualNetwork
+
+func (s segments) Listen(ifc *net.Interface, opts mdns.SocketOptions) (mdns.PacketConn, error) {
+	return s[ifc.Index].Listen(ifc, opts)
+}
+
+// reflectBetween runs a Reflector across segs until the test ends.
+func reflectBetween(t *testing.T, segs segments, rf *mdns.Reflector) {
+	for i := range segs {
+		rf.Interfaces = append(rf.Interfaces, &net.Interface{Index: i, Name: "seg"})
+	}
+	rf.Transport = segs
+	hosts := make(map[int]int, len(segs))
+	for i, vn := range segs {
+		hosts[i] = len(vn.Addrs())
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go rf.Run(ctx)
+	// wait for the Reflector to join every segment
+	for i, vn := range segs {
+		for deadline := time.Now().Add(time.Second); len(vn.Addrs()) == hosts[i]; time.Sleep(time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatal("Reflector never joined its segments")
+			}
+		}
+	}
+}
+
+// segmentHost joins vn as a host that sees everything on it.
+func segmentHost(t *testing.T, vn *mdns.VirtualNetwork) mdns.PacketConn {
+	c, err := vn.Listen(nil, mdns.DefaultSocketOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// heard returns every message c receives within d.
+func heard(t *testing.T, c mdns.PacketConn, d time.Duration) []*mdns.Message {
+	ms, _ := heardAt(t, c, d)
+	return ms
+}
+
+// heardAt is heard, noting when each message arrived.
+func heardAt(t *testing.T, c mdns.PacketConn, d time.Duration) ([]*mdns.Message, []time.Time) {
+	var ms []*mdns.Message
+	var at []time.Time
+	buf := make([]byte, mdns.MaximumPacketSize)
+	c.SetDeadline(time.Now().Add(d))
+	for {
+		n, _, _, err := c.ReadFrom(buf)
+		if err != nil {
+			return ms, at
+		}
+		m := &mdns.Message{}
+		if err = m.Decode(buf[:n], 100); err != nil {
+			t.Errorf("message failed to decode: %+v", err)
+			continue
+		}
+		ms = append(ms, m)
+		at = append(at, time.Now())
+	}
+}
+
+var mDNSGroup = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+func TestReflector(t *testing.T) {
+	segs := segments{1001: {}, 1002: {}}
+	sender, receiver := segmentHost(t, segs[1001]), segmentHost(t, segs[1002])
+	reflectBetween(t, segs, &mdns.Reflector{Deny: []string{"_googlecast._tcp"}})
+
+	printer := mustSubject(t, "printer.local.")
+	ipp := mustSubject(t, "_ipp._tcp.local.")
+	cast := mustSubject(t, "_googlecast._tcp.local.")
+	m := &mdns.Message{Flags: 0x8400, Answer: []mdns.Record{
+		{Subject: printer, Type: mdns.RecordTypeA, Class: 0x8001, TTL: 120, Value: &mdns.RecordA{Addr: net.IPv4(10, 0, 0, 5)}},
+		{Subject: printer, Type: mdns.RecordTypeA, Class: 0x8001, TTL: 120, Value: &mdns.RecordA{Addr: net.IPv4(169, 254, 3, 3)}},
+		{Subject: printer, Type: mdns.RecordTypeAAAA, Class: 0x8001, TTL: 120, Value: &mdns.RecordAAAA{Addr: net.ParseIP("fe80::1")}},
+		{Subject: ipp, Type: mdns.RecordTypePTR, Class: 1, TTL: 4500, Value: &mdns.RecordPTR{Name: *mustSubject(t, "Printer._ipp._tcp.local.")}},
+		{Subject: cast, Type: mdns.RecordTypePTR, Class: 1, TTL: 4500, Value: &mdns.RecordPTR{Name: *mustSubject(t, "Kitchen._googlecast._tcp.local.")}},
+	}}
+	// announced twice, as a responder does, a second apart or less
+	sender.WriteTo(m.Encode(), mDNSGroup)
+	time.Sleep(200 * time.Millisecond)
+	sender.WriteTo(m.Encode(), mDNSGroup)
+
+	ms := heard(t, receiver, 500*time.Millisecond)
+	if len(ms) != 2 {
+		t.Fatalf("the second segment heard %d messages, expected both announcements", len(ms))
+	}
+	for _, r := range ms[0].Answer {
+		switch v := r.Value.(type) {
+		case *mdns.RecordA:
+			if !v.Addr.Equal(net.IPv4(10, 0, 0, 5)) {
+				t.Errorf("link-local address %s was reflected", v.Addr)
+			}
+		case *mdns.RecordAAAA:
+			t.Errorf("link-local address %s was reflected", v.Addr)
+		case *mdns.RecordPTR:
+			if r.Subject.String() != "_ipp._tcp.local." {
+				t.Errorf("denied record %s was reflected", r.Subject)
+			}
+		}
+	}
+	if len(ms[0].Answer) != 2 {
+		t.Errorf("reflected message had %d answers, expected 2", len(ms[0].Answer))
+	}
+}
+
+func TestReflectorAllow(t *testing.T) {
+	segs := segments{1001: {}, 1002: {}}
+	sender, receiver := segmentHost(t, segs[1001]), segmentHost(t, segs[1002])
+	reflectBetween(t, segs, &mdns.Reflector{Allow: []string{"_googlecast._tcp"}})
+
+	for _, name := range []string{"_ipp._tcp.local.", "_googlecast._tcp.local.", "printer.local."} {
+		q, err := mdns.NewQuestion(name, mdns.RecordTypeAny)
+		if err != nil {
+			t.Fatal(err)
+		}
+		q.WriteTo(&groupWriter{sender})
+	}
+	var names []string
+	for _, m := range heard(t, receiver, 300*time.Millisecond) {
+		for _, q := range m.Questions {
+			names = append(names, q.Subject.String())
+		}
+	}
+	if len(names) != 2 || names[0] != "_googlecast._tcp.local." || names[1] != "printer.local." {
+		t.Errorf("reflected questions for %q, expected the Cast service and the host", names)
+	}
+}
+
+func TestReflectorLoop(t *testing.T) {
+	segs := segments{1001: {}, 1002: {}}
+	sender, receiver := segmentHost(t, segs[1001]), segmentHost(t, segs[1002])
+	// two reflectors between the same segments hear one another's reflections
+	reflectBetween(t, segs, &mdns.Reflector{})
+	reflectBetween(t, segs, &mdns.Reflector{})
+
+	printer := mustSubject(t, "printer.local.")
+	m := &mdns.Message{Flags: 0x8400, Answer: []mdns.Record{
+		{Subject: printer, Type: mdns.RecordTypeA, Class: 0x8001, TTL: 120, Value: &mdns.RecordA{Addr: net.IPv4(10, 0, 0, 5)}},
+		{Subject: printer, Type: mdns.RecordTypeAAAA, Class: 0x8001, TTL: 120, Value: &mdns.RecordAAAA{Addr: net.ParseIP("fe80::1")}},
+	}}
+	sender.WriteTo(m.Encode(), mDNSGroup)
+
+	done := make(chan int)
+	go func() { done <- len(heard(t, receiver, 500*time.Millisecond)) }()
+	// either reflector may pass on the other's reflection before hearing the
+	// original, but no further
+	if n := len(heard(t, sender, 500*time.Millisecond)); n < 1 || n > 2 {
+		t.Errorf("the first segment heard %d messages, expected the original and one reflection at most", n)
+	}
+	if n := <-done; n < 1 || n > 2 {
+		t.Errorf("the second segment heard %d messages, expected one from each reflector at most", n)
+	}
+}
+
+// groupWriter writes to the mDNS group on a PacketConn.
+type groupWriter struct {
+	c mdns.PacketConn
+}
+
+func (w *groupWriter) Write(b []byte) (int, error) {
+	return w.c.WriteTo(b, mDNSGroup)
+}
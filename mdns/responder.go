@@ -0,0 +1,567 @@
+package mdns
+
+import (
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Announcement timing from RFC 6762 sec 8.3: at least two unsolicited
+// responses, one second apart.
+const (
+	announceCount    = 2
+	announceInterval = time.Second
+)
+
+// Default TTLs from RFC 6762 sec 10: records naming a host get 120 seconds,
+// everything else 75 minutes.
+const (
+	hostRecordTTL  = 120
+	otherRecordTTL = 4500
+)
+
+// A Responder publishes records on the link. It answers queries for them,
+// announces them when they are published or changed, and says goodbye (by
+// sending them with a TTL of zero) when they are withdrawn or the Responder
+// is closed. Records with the cache-flush bit set in their Class are treated
+// as unique to this host; others are shared.
+//
+// Close should be called before the process exits, so that other hosts on
+// the link forget the records promptly rather than waiting out their TTLs.
+type Responder struct {
+	conn PacketConn
+	addr *net.UDPAddr
+	link *linkNets
+
+	mu       sync.Mutex
+	recs     []Record
+	services map[*Service][]Record
+	host     string
+	probes   []*prober
+	closed   bool
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewResponder starts a Responder on ifc (or an OS-chosen interface, if nil).
+func NewResponder(ifc *net.Interface) (*Responder, error) {
+	return NewResponderTransport(UDPTransport{}, ifc)
+}
+
+// NewResponderTransport starts a Responder on ifc, listening through t.
+func NewResponderTransport(t Transport, ifc *net.Interface) (*Responder, error) {
+	conn, err := t.Listen(ifc, DefaultSocketOptions())
+	if err != nil {
+		return nil, err
+	}
+	rs := &Responder{
+		conn:     conn,
+		addr:     mDNSGroup,
+		services: map[*Service][]Record{},
+		done:     make(chan struct{}),
+	}
+	if _, ok := t.(UDPTransport); ok && ifc != nil {
+		// the socket hears the mDNS group on every interface, but we should
+		// only answer the hosts on our own
+		rs.link = &linkNets{ifc: ifc}
+	}
+	rs.wg.Add(1)
+	go rs.serve()
+	return rs, nil
+}
+
+// Publish adds recs to the records this Responder answers for, and announces
+// any that were not already published. A record already published with the
+// same name, type and data has its TTL updated instead.
+func (rs *Responder) Publish(recs ...Record) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if rs.closed {
+		return ResponderClosed
+	}
+	rs.publish(recs)
+	return nil
+}
+
+// publish is Publish with rs.mu held.
+func (rs *Responder) publish(recs []Record) {
+	var fresh []Record
+	for _, r := range recs {
+		i := rs.find(&r)
+		if i >= 0 {
+			rs.recs[i] = r
+			continue
+		}
+		rs.recs = append(rs.recs, r)
+		fresh = append(fresh, r)
+	}
+	rs.announce(fresh)
+}
+
+// Withdraw stops answering for recs and sends a goodbye for each of them.
+func (rs *Responder) Withdraw(recs ...Record) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if rs.closed {
+		return ResponderClosed
+	}
+	rs.goodbye(rs.remove(recs))
+	return nil
+}
+
+// Close withdraws every published record, sending goodbyes, and stops the
+// Responder.
+func (rs *Responder) Close() error {
+	rs.mu.Lock()
+	if rs.closed {
+		rs.mu.Unlock()
+		return nil
+	}
+	rs.closed = true
+	rs.goodbye(rs.recs)
+	rs.recs = nil
+	close(rs.done)
+	rs.mu.Unlock()
+
+	rs.conn.Close()
+	rs.wg.Wait()
+	return nil
+}
+
+// find returns the index in rs.recs of the record matching r in name, type
+// and data, or -1. rs.mu must be held.
+func (rs *Responder) find(r *Record) int {
+	k := recordKey(r)
+	for i := range rs.recs {
+		if recordKey(&rs.recs[i]) == k {
+			return i
+		}
+	}
+	return -1
+}
+
+// remove takes recs out of rs.recs, returning the ones that were there.
+// rs.mu must be held.
+func (rs *Responder) remove(recs []Record) []Record {
+	var gone []Record
+	for _, r := range recs {
+		i := rs.find(&r)
+		if i < 0 {
+			continue
+		}
+		gone = append(gone, rs.recs[i])
+		rs.recs = append(rs.recs[:i], rs.recs[i+1:]...)
+	}
+	return gone
+}
+
+// announce sends recs unsolicited, announceCount times. Any record withdrawn
+// or replaced in the meantime is left out of later repetitions. rs.mu must be
+// held.
+func (rs *Responder) announce(recs []Record) {
+	if len(recs) == 0 {
+		return
+	}
+	rs.wg.Add(1)
+	go func() {
+		defer rs.wg.Done()
+		for i := 0; i < announceCount; i++ {
+			if i > 0 {
+				select {
+				case <-rs.done:
+					return
+				case <-time.After(announceInterval):
+				}
+			}
+			rs.mu.Lock()
+			live := make([]Record, 0, len(recs))
+			for _, r := range recs {
+				if rs.find(&r) >= 0 {
+					live = append(live, r)
+				}
+			}
+			rs.mu.Unlock()
+			if len(live) == 0 {
+				return
+			}
+			rs.send(&Message{Flags: flagResponse | flagAuthoritative, Answer: live}, rs.addr)
+		}
+	}()
+}
+
+// goodbye sends recs with a TTL of zero (RFC 6762 sec 10.1).
+func (rs *Responder) goodbye(recs []Record) {
+	if len(recs) == 0 {
+		return
+	}
+	bye := make([]Record, len(recs))
+	for i := range recs {
+		bye[i] = recs[i]
+		bye[i].TTL = 0
+	}
+	rs.send(&Message{Flags: flagResponse | flagAuthoritative, Answer: bye}, rs.addr)
+}
+
+// send writes m to dest, splitting its answers over several packets if they
+// will not fit in one.
+func (rs *Responder) send(m *Message, dest *net.UDPAddr) {
+	b := m.Encode()
+	if len(b) <= mDNSMaximumPacketSize || len(m.Answer) < 2 {
+		rs.conn.WriteTo(b, dest)
+		return
+	}
+	half := len(m.Answer) / 2
+	a, z := *m, *m
+	a.Answer, a.Additional = m.Answer[:half], nil
+	z.Answer, z.Questions = m.Answer[half:], nil
+	rs.send(&a, dest)
+	rs.send(&z, dest)
+}
+
+func (rs *Responder) serve() {
+	defer rs.wg.Done()
+	buf := make([]byte, mDNSMaximumPacketSize)
+	for {
+		n, src, _, err := rs.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if rs.link != nil && !rs.link.contains(src.IP) {
+			continue
+		}
+		m := &Message{}
+		if m.Decode(buf[:n], 1000) != nil {
+			continue
+		}
+		if m.Flags&flagResponse != 0 {
+			rs.heardResponse(m)
+			continue
+		}
+		if len(m.Authority) > 0 {
+			rs.heardProbe(m)
+		}
+		rs.answer(m, src)
+	}
+}
+
+// answersQuestion reports whether r answers q.
+func answersQuestion(r *Record, q *Question) bool {
+	if q.Type != RecordTypeAny && q.Type != r.Type {
+		return false
+	}
+	return r.Subject.equalFold(q.Subject)
+}
+
+// knownAnswer reports whether the querier listed r among the answers it
+// already has, with at least half of r's TTL remaining (RFC 6762 sec 7.1).
+func knownAnswer(known []Record, r *Record) bool {
+	k := recordKey(r)
+	for i := range known {
+		if known[i].TTL >= r.TTL/2 && recordKey(&known[i]) == k {
+			return true
+		}
+	}
+	return false
+}
+
+// answer replies to the query m received from src.
+func (rs *Responder) answer(m *Message, src *net.UDPAddr) {
+	legacy := src.Port != 5353
+	unicast := legacy
+	var ans []Record
+	shared := false
+
+	rs.mu.Lock()
+	for qi := range m.Questions {
+		q := &m.Questions[qi]
+		if q.Class&classCacheFlush != 0 {
+			unicast = true
+		}
+		for i := range rs.recs {
+			r := &rs.recs[i]
+			if answersQuestion(r, q) && !knownAnswer(m.Answer, r) && !containsRecord(ans, r) {
+				ans = append(ans, *r)
+				shared = shared || r.Class&classCacheFlush == 0
+			}
+		}
+	}
+	extra := rs.additional(ans)
+	rs.mu.Unlock()
+
+	if len(ans) == 0 {
+		return
+	}
+	resp := &Message{Flags: flagResponse | flagAuthoritative, Answer: ans, Additional: extra}
+	if !unicast {
+		if !shared {
+			rs.send(resp, rs.addr)
+			return
+		}
+		// shared records are answered after a random delay, so that the
+		// responses from every host holding them don't collide (sec 6)
+		rs.wg.Add(1)
+		go func() {
+			defer rs.wg.Done()
+			select {
+			case <-rs.done:
+			case <-time.After(time.Duration(20+rand.Intn(100)) * time.Millisecond):
+				rs.send(resp, rs.addr)
+			}
+		}()
+		return
+	}
+	if legacy {
+		// RFC 6762 sec 6.7: echo the ID and question, and don't confuse a
+		// plain DNS resolver with cache-flush bits or long TTLs
+		resp.ID = m.ID
+		resp.Questions = m.Questions
+		for _, sec := range [][]Record{resp.Answer, resp.Additional} {
+			for i := range sec {
+				sec[i].Class &^= classCacheFlush
+				if sec[i].TTL > 10 {
+					sec[i].TTL = 10
+				}
+			}
+		}
+	}
+	rs.send(resp, src)
+}
+
+// additional gathers the records that RFC 6763 sec 12 suggests sending along
+// with ans: the SRV and TXT records of a PTR's target, and the addresses of an
+// SRV's target. rs.mu must be held.
+func (rs *Responder) additional(ans []Record) []Record {
+	var extra []Record
+	add := func(name *Subject, types ...RecordType) {
+		for i := range rs.recs {
+			r := &rs.recs[i]
+			if !r.Subject.equalFold(name) || containsRecord(ans, r) || containsRecord(extra, r) {
+				continue
+			}
+			for _, t := range types {
+				if r.Type == t {
+					extra = append(extra, *r)
+				}
+			}
+		}
+	}
+	for i := range ans {
+		if ptr, ok := ans[i].Value.(*RecordPTR); ok {
+			add(&ptr.Name, RecordTypeSRV, RecordTypeTXT)
+		}
+	}
+	for i := range ans {
+		if srv, ok := ans[i].Value.(*RecordSRV); ok {
+			add(&srv.Target, RecordTypeA, RecordTypeAAAA)
+		}
+	}
+	for i := 0; i < len(extra); i++ {
+		if srv, ok := extra[i].Value.(*RecordSRV); ok {
+			add(&srv.Target, RecordTypeA, RecordTypeAAAA)
+		}
+	}
+	return extra
+}
+
+func containsRecord(recs []Record, r *Record) bool {
+	k := recordKey(r)
+	for i := range recs {
+		if recordKey(&recs[i]) == k {
+			return true
+		}
+	}
+	return false
+}
+
+// A Service describes a DNS-SD service instance (RFC 6763) to be published by
+// a Responder.
+type Service struct {
+	Instance string   // a user-friendly name, such as "Living Room"; kept whole, dots included
+	Type     string   // the service type, such as "_http._tcp"
+	Domain   string   // if empty, "local." is used
+	Host     string   // the host providing the service, such as "myhost.local."; see SetHostName
+	Port     uint16   // the port the service listens on
+	Text     []string // "key=value" pairs for the TXT record
+}
+
+func (s *Service) domain() string {
+	if s.Domain == "" {
+		return "local."
+	}
+	return strings.TrimSuffix(s.Domain, ".") + "."
+}
+
+func (s *Service) typeName() string {
+	return strings.TrimSuffix(s.Type, ".") + "." + s.domain()
+}
+
+// instanceName builds the name of s, its instance a single label.
+func (s *Service) instanceName() (*Subject, error) {
+	return instanceSubject(s.Instance, s.typeName())
+}
+
+// encodeTXT renders txt as the length-prefixed strings of a TXT record. An
+// empty set is a single empty string, as RFC 6763 sec 6.1 requires.
+func encodeTXT(txt []string) string {
+	if len(txt) == 0 {
+		return "\x00"
+	}
+	var b strings.Builder
+	for _, t := range txt {
+		if len(t) > 255 {
+			t = t[:255]
+		}
+		b.WriteByte(byte(len(t)))
+		b.WriteString(t)
+	}
+	return b.String()
+}
+
+// txtRecord builds the TXT record for s.
+func (s *Service) txtRecord() (Record, error) {
+	inst, err := s.instanceName()
+	if err != nil {
+		return Record{}, err
+	}
+	return Record{Subject: inst, Type: RecordTypeTXT, Class: classCacheFlush | 1, TTL: otherRecordTTL,
+		Value: &RecordTXT{Text: encodeTXT(s.Text)}}, nil
+}
+
+// records builds the PTR, SRV and TXT records describing s, plus the
+// service-type enumeration PTR from RFC 6763 sec 9. host is used as the SRV
+// target if s has no Host of its own.
+func (s *Service) records(host string) ([]Record, error) {
+	if s.Host != "" {
+		host = s.Host
+	}
+	if host == "" {
+		return nil, ServiceHostUnknown
+	}
+	enum, typ := &Subject{}, &Subject{}
+	err := enum.FromString("_services._dns-sd._udp." + s.domain())
+	if err != nil {
+		return nil, err
+	}
+	err = typ.FromString(s.typeName())
+	if err != nil {
+		return nil, err
+	}
+	inst, err := s.instanceName()
+	if err != nil {
+		return nil, err
+	}
+	srv := &RecordSRV{Port: s.Port}
+	err = srv.Target.FromString(host)
+	if err != nil {
+		return nil, err
+	}
+	txt, err := s.txtRecord()
+	if err != nil {
+		return nil, err
+	}
+	return []Record{
+		{Subject: typ, Type: RecordTypePTR, Class: 1, TTL: otherRecordTTL, Value: &RecordPTR{Name: *inst}},
+		{Subject: inst, Type: RecordTypeSRV, Class: classCacheFlush | 1, TTL: hostRecordTTL, Value: srv},
+		txt,
+		{Subject: enum, Type: RecordTypePTR, Class: 1, TTL: otherRecordTTL, Value: &RecordPTR{Name: *typ}},
+	}, nil
+}
+
+// SetHostName sets the host name used as the SRV target of services
+// registered without a Host of their own. HostPublisher sets this on the
+// Responders it runs.
+func (rs *Responder) SetHostName(name string) {
+	rs.mu.Lock()
+	rs.host = name
+	rs.mu.Unlock()
+}
+
+// HostName returns the name set by SetHostName.
+func (rs *Responder) HostName() string {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return rs.host
+}
+
+// Register publishes s.
+func (rs *Responder) Register(s *Service) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if rs.closed {
+		return ResponderClosed
+	}
+	if rs.services[s] != nil {
+		return ServiceAlreadyRegistered
+	}
+	recs, err := s.records(rs.host)
+	if err != nil {
+		return err
+	}
+	rs.publish(recs)
+	rs.services[s] = recs
+	return nil
+}
+
+// Unregister withdraws s, sending goodbyes for its records. The enumeration
+// PTR for its type is kept while any other registered service shares it.
+func (rs *Responder) Unregister(s *Service) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if rs.closed {
+		return ResponderClosed
+	}
+	recs, ok := rs.services[s]
+	if !ok {
+		return ServiceNotRegistered
+	}
+	delete(rs.services, s)
+	var gone []Record
+	for _, r := range recs {
+		inUse := false
+		for _, other := range rs.services {
+			if containsRecord(other, &r) {
+				inUse = true
+				break
+			}
+		}
+		if !inUse {
+			gone = append(gone, r)
+		}
+	}
+	rs.goodbye(rs.remove(gone))
+	return nil
+}
+
+// SetText replaces the TXT record of the registered service s with txt. Only
+// the new TXT record is announced, with its cache-flush bit telling other
+// hosts to discard the old one.
+func (rs *Responder) SetText(s *Service, txt []string) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if rs.closed {
+		return ResponderClosed
+	}
+	recs, ok := rs.services[s]
+	if !ok {
+		return ServiceNotRegistered
+	}
+	s.Text = txt
+	nt, err := s.txtRecord()
+	if err != nil {
+		return err
+	}
+	for i := range recs {
+		if recs[i].Type != RecordTypeTXT {
+			continue
+		}
+		if j := rs.find(&recs[i]); j >= 0 {
+			rs.recs[j] = nt
+		}
+		recs[i] = nt
+	}
+	rs.announce([]Record{nt})
+	return nil
+}
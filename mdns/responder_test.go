@@ -0,0 +1,208 @@
+package mdns_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ironiridis/klonderoo/mdns"
+)
+
+// virtualResponder starts a Responder on vn for the host box.local.
+func virtualResponder(t *testing.T, vn *mdns.VirtualNetwork) *mdns.Responder {
+	rs, err := mdns.NewResponderTransport(vn, nil)
+	if err != nil {
+		t.Fatalf("NewResponderTransport returned %+v", err)
+	}
+	t.Cleanup(func() { rs.Close() })
+	rs.SetHostName("box.local.")
+	return rs
+}
+
+func TestResponderAnnounce(t *testing.T) {
+	vn := &mdns.VirtualNetwork{}
+	obs := segmentHost(t, vn)
+	rs := virtualResponder(t, vn)
+	err := rs.Register(&mdns.Service{Instance: "Printer", Type: "_ipp._tcp", Port: 631})
+	if err != nil {
+		t.Fatalf("Responder.Register returned %+v", err)
+	}
+
+	ms, at := heardAt(t, obs, 1500*time.Millisecond)
+	if len(ms) != 2 {
+		t.Fatalf("heard %d announcements, expected 2", len(ms))
+	}
+	if gap := at[1].Sub(at[0]); gap < 900*time.Millisecond || gap > 1200*time.Millisecond {
+		t.Errorf("announcements were %v apart, expected a second", gap)
+	}
+	for _, m := range ms {
+		if len(m.Answer) != 4 {
+			t.Errorf("announcement had %d answers, expected the service's 4 records", len(m.Answer))
+		}
+	}
+}
+
+func TestResponderDottedInstance(t *testing.T) {
+	vn := &mdns.VirtualNetwork{}
+	obs := segmentHost(t, vn)
+	rs := virtualResponder(t, vn)
+	inst := "Dr. Smith's Printer"
+	if err := rs.Register(&mdns.Service{Instance: inst, Type: "_ipp._tcp", Port: 631}); err != nil {
+		t.Fatalf("Responder.Register returned %+v", err)
+	}
+	ms := heard(t, obs, 100*time.Millisecond)
+	if len(ms) != 1 {
+		t.Fatalf("heard %d announcements, expected 1", len(ms))
+	}
+	for _, r := range ms[0].Answer {
+		name := r.Subject.Encode()
+		if ptr, ok := r.Value.(*mdns.RecordPTR); ok {
+			name = ptr.Name.Encode()
+			if r.Subject.String() == "_services._dns-sd._udp.local." {
+				continue
+			}
+		}
+		if int(name[0]) != len(inst) || string(name[1:1+len(inst)]) != inst {
+			t.Errorf("%v record was published for %q, not the instance as one label", r.Type, name)
+		}
+	}
+}
+
+func TestResponderGoodbye(t *testing.T) {
+	vn := &mdns.VirtualNetwork{}
+	obs := segmentHost(t, vn)
+	rs := virtualResponder(t, vn)
+	a := &mdns.Service{Instance: "Printer", Type: "_ipp._tcp", Port: 631}
+	b := &mdns.Service{Instance: "Scanner", Type: "_ipp._tcp", Port: 632}
+	for _, s := range []*mdns.Service{a, b} {
+		if err := rs.Register(s); err != nil {
+			t.Fatalf("Responder.Register returned %+v", err)
+		}
+	}
+	heardAt(t, obs, 100*time.Millisecond)
+
+	goodbyes := func(what string, want int) {
+		t.Helper()
+		ms, _ := heardAt(t, obs, 100*time.Millisecond)
+		if len(ms) != 1 {
+			t.Fatalf("heard %d messages on %s, expected a goodbye", len(ms), what)
+		}
+		for _, r := range ms[0].Answer {
+			if r.TTL != 0 {
+				t.Errorf("goodbye on %s held %s with TTL %d", what, r.Subject, r.TTL)
+			}
+		}
+		if len(ms[0].Answer) != want {
+			t.Errorf("goodbye on %s held %d records, expected %d", what, len(ms[0].Answer), want)
+		}
+	}
+	// the enumeration PTR is still needed by the other service
+	if err := rs.Unregister(a); err != nil {
+		t.Fatalf("Responder.Unregister returned %+v", err)
+	}
+	goodbyes("Unregister", 3)
+	rs.Close()
+	goodbyes("Close", 4)
+}
+
+func TestResponderSetText(t *testing.T) {
+	vn := &mdns.VirtualNetwork{}
+	obs := segmentHost(t, vn)
+	rs := virtualResponder(t, vn)
+	s := &mdns.Service{Instance: "Printer", Type: "_ipp._tcp", Port: 631, Text: []string{"rp=old"}}
+	if err := rs.Register(s); err != nil {
+		t.Fatalf("Responder.Register returned %+v", err)
+	}
+	if ms, _ := heardAt(t, obs, 1500*time.Millisecond); len(ms) != 2 {
+		t.Fatalf("heard %d announcements, expected 2", len(ms))
+	}
+
+	if err := rs.SetText(s, []string{"rp=new"}); err != nil {
+		t.Fatalf("Responder.SetText returned %+v", err)
+	}
+	ms, _ := heardAt(t, obs, 1500*time.Millisecond)
+	if len(ms) != 2 {
+		t.Fatalf("heard %d announcements of the new text, expected 2", len(ms))
+	}
+	for _, m := range ms {
+		if len(m.Answer) != 1 || m.Answer[0].Type != mdns.RecordTypeTXT {
+			t.Fatalf("announcement of the new text held %d answers, expected the TXT record alone", len(m.Answer))
+		}
+		txt := m.Answer[0].Value.(*mdns.RecordTXT)
+		if txt.Text != "\x06rp=new" || m.Answer[0].Class != 0x8001 {
+			t.Errorf("announced TXT record %q with class %04x", txt.Text, m.Answer[0].Class)
+		}
+	}
+}
+
+func TestResponderKnownAnswer(t *testing.T) {
+	vn := &mdns.VirtualNetwork{}
+	rs := virtualResponder(t, vn)
+	if err := rs.Register(&mdns.Service{Instance: "Printer", Type: "_ipp._tcp", Port: 631}); err != nil {
+		t.Fatalf("Responder.Register returned %+v", err)
+	}
+	obs := segmentHost(t, vn) // joins after the announcements are sent
+
+	ipp := mustSubject(t, "_ipp._tcp.local.")
+	ptr := mdns.Record{Subject: ipp, Type: mdns.RecordTypePTR, Class: 1, Value: &mdns.RecordPTR{Name: *mustSubject(t, "Printer._ipp._tcp.local.")}}
+	for _, try := range []struct {
+		ttl     uint32 // of the known answer, or 0 for none
+		answers bool
+	}{
+		{0, true},
+		{4500, false},
+		{2300, false},
+		{2000, true}, // less than half the TTL left
+	} {
+		q := &mdns.Message{Questions: []mdns.Question{{Subject: ipp, Type: mdns.RecordTypePTR, Class: 1}}}
+		if try.ttl > 0 {
+			ptr.TTL = try.ttl
+			q.Answer = []mdns.Record{ptr}
+		}
+		obs.WriteTo(q.Encode(), mDNSGroup)
+		answered := false
+		ms, _ := heardAt(t, obs, 300*time.Millisecond)
+		for _, m := range ms {
+			answered = answered || m.IsResponse()
+		}
+		if answered != try.answers {
+			t.Errorf("with a known answer of TTL %d, answered %v, expected %v", try.ttl, answered, try.answers)
+		}
+	}
+}
+
+func TestResponderRegisterRace(t *testing.T) {
+	vn := &mdns.VirtualNetwork{}
+	rs := virtualResponder(t, vn)
+	s := &mdns.Service{Instance: "Printer", Type: "_ipp._tcp", Port: 631}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- rs.Register(s)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	ok := 0
+	for err := range errs {
+		switch err {
+		case nil:
+			ok++
+		case mdns.ServiceAlreadyRegistered:
+		default:
+			t.Errorf("Responder.Register returned %+v", err)
+		}
+	}
+	if ok != 1 {
+		t.Errorf("%d concurrent registrations of one service succeeded, expected 1", ok)
+	}
+
+	rs.Close()
+	if err := rs.Register(&mdns.Service{Instance: "Scanner", Type: "_ipp._tcp", Port: 632}); err != mdns.ResponderClosed {
+		t.Errorf("Responder.Register after Close returned %+v", err)
+	}
+}
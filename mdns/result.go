@@ -1,5 +1,7 @@
 package mdns
 
+import "sync"
+
 // Result is a response to a Query.
 type Result struct {
 	transactionID uint16 // Always zero; mDNS responders don't seem to honor it
@@ -7,6 +9,11 @@ type Result struct {
 	Answer        []Record
 	Additional    []Record
 	maxrecs       int
+	authority     []Record // storage reused while decoding
+
+	// Warnings lists the records whose data could not be parsed. Such
+	// records are kept in Answer or Additional, holding a RecordUndecoded.
+	Warnings []*DecodeError
 }
 
 func (d *Result) validateFlags() error {
@@ -19,7 +26,13 @@ func (d *Result) validateFlags() error {
 	if d.flags&0x0070 != 0x0000 {
 		return ResponseReservedBitsHigh
 	}
-	switch d.flags & 0x000f {
+	return rcodeError(d.flags)
+}
+
+// rcodeError returns the error matching the response code in flags, or nil
+// if it indicates success.
+func rcodeError(flags uint16) error {
+	switch flags & flagResponseCode {
 	case 0:
 		return nil
 	case 1:
@@ -35,74 +48,59 @@ func (d *Result) validateFlags() error {
 	default:
 		return ResponseCodeOtherFailure
 	}
-
 }
 
-func (d *Result) readFrom(r mDNSPacketReader) (err error) {
-	d.transactionID, err = readUint16(r)
-	if err != nil {
-		return
-	}
-	d.flags, err = readUint16(r)
-	if err != nil {
-		return
+// decode parses buf, a whole response packet, into Result, reusing whatever
+// record storage it already has.
+func (d *Result) decode(buf []byte) (err error) {
+	dec := &decoder{buf: buf}
+	var hdr [6]uint16
+	for i := range hdr {
+		hdr[i], err = dec.uint16()
+		if err != nil {
+			return &DecodeError{Offset: int64(i * 2), Section: "header", Err: err}
+		}
 	}
+	d.transactionID, d.flags = hdr[0], hdr[1]
 	err = d.validateFlags()
 	if err != nil {
-		return
-	}
-	qdcount, err := readUint16(r)
-	if err != nil {
-		return
+		return &DecodeError{Offset: 2, Section: "header", Err: err}
 	}
-	if qdcount > 0 {
-		err = ResponseQuestionCountNonzero
-		return
+	if hdr[2] > 0 {
+		return &DecodeError{Offset: 4, Section: "header", Err: ResponseQuestionCountNonzero}
 	}
-	ancount, err := readUint16(r)
-	if err != nil {
-		return
+	if off := countOverflow(&hdr, 3, d.maxrecs); off >= 0 {
+		return &DecodeError{Offset: off, Section: "header", Err: ResponseTooLarge}
 	}
-	nscount, err := readUint16(r)
+
+	d.Warnings = d.Warnings[:0]
+	d.Answer, err = decodeRecords(dec, d.Answer, hdr[3], "answer", &d.Warnings)
 	if err != nil {
 		return
 	}
-	arcount, err := readUint16(r)
+	// authority records are decoded only to get past them, then discarded
+	d.authority, err = decodeRecords(dec, d.authority, hdr[4], "authority", &d.Warnings)
 	if err != nil {
 		return
 	}
+	d.Additional, err = decodeRecords(dec, d.Additional, hdr[5], "additional", &d.Warnings)
+	return
+}
 
-	if int(ancount+nscount+arcount) > d.maxrecs {
-		err = ResponseTooLarge
-		return
-	}
+var resultPool = sync.Pool{New: func() interface{} { return new(Result) }}
 
-	for ancount > 0 {
-		ancount--
-		rec := Record{}
-		err = rec.readFrom(r)
-		if err != nil {
-			return
-		}
-		d.Answer = append(d.Answer, rec)
-	}
-	for nscount > 0 {
-		nscount--
-		rec := Record{}
-		err = rec.readFrom(r)
-		if err != nil {
-			return
-		}
-		// records are discarded
-	}
-	for arcount > 0 {
-		arcount--
-		rec := Record{}
-		err = rec.readFrom(r)
-		if err != nil {
-			return
-		}
-		d.Additional = append(d.Additional, rec)
-	}
-	return nil
+// newResult returns an empty Result, reusing a released one if there is one.
+func newResult(maxrecs int) *Result {
+	r := resultPool.Get().(*Result)
+	r.maxrecs = maxrecs
+	return r
+}
+
+// Release hands Result back to be reused for decoding a later response. It is
+// optional, but saves a good deal of allocation when many responses arrive.
+// Nothing taken from Result, including its records, names and addresses, may
+// be used after Release; copy out what you need to keep first.
+func (d *Result) Release() {
+	d.Warnings = d.Warnings[:0]
+	resultPool.Put(d)
 }
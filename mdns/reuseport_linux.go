@@ -0,0 +1,7 @@
+//go:build !mips && !mipsle && !mips64 && !mips64le && !sparc64
+
+package mdns
+
+// soReusePort is SO_REUSEPORT, which the syscall package omits on Linux. Its
+// value differs on a few architectures; see reuseport_linux_mipsx.go.
+const soReusePort = 0xf
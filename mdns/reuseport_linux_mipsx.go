@@ -0,0 +1,8 @@
+//go:build linux && (mips || mipsle || mips64 || mips64le || sparc64)
+
+package mdns
+
+// soReusePort is SO_REUSEPORT, which the syscall package omits on Linux. MIPS
+// and SPARC number their socket options after the systems Linux was first
+// ported from there.
+const soReusePort = 0x200
@@ -0,0 +1,65 @@
+package mdns
+
+import (
+	"context"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+const hexDigits = "0123456789abcdef"
+
+// ReverseName returns the in-addr.arpa or ip6.arpa name under which PTR
+// records for addr are published, as described in RFC 1035 sec 3.5 and
+// RFC 3596 sec 2.5.
+func ReverseName(addr netip.Addr) string {
+	addr = addr.Unmap()
+	var b strings.Builder
+	if addr.Is4() {
+		a := addr.As4()
+		for i := len(a) - 1; i >= 0; i-- {
+			b.WriteString(strconv.Itoa(int(a[i])))
+			b.WriteByte('.')
+		}
+		b.WriteString("in-addr.arpa.")
+		return b.String()
+	}
+	a := addr.As16()
+	for i := len(a) - 1; i >= 0; i-- {
+		b.WriteByte(hexDigits[a[i]&0xf])
+		b.WriteByte('.')
+		b.WriteByte(hexDigits[a[i]>>4])
+		b.WriteByte('.')
+	}
+	b.WriteString("ip6.arpa.")
+	return b.String()
+}
+
+// LookupAddr looks up addr using DefaultResolver.
+func LookupAddr(ctx context.Context, addr netip.Addr) ([]string, error) {
+	return DefaultResolver.LookupAddr(ctx, addr)
+}
+
+// LookupAddr performs a reverse lookup for addr, returning the names that
+// devices on the link publish for it (usually a single "<host>.local." name).
+func (r *Resolver) LookupAddr(ctx context.Context, addr netip.Addr) ([]string, error) {
+	name := ReverseName(addr)
+	s := &Subject{}
+	err := s.FromString(name)
+	if err != nil {
+		return nil, err
+	}
+	recs, err := r.query(ctx, s, RecordTypePTR)
+	targets := ptrTargets(recs, s)
+	if len(targets) == 0 {
+		if err == nil {
+			err = LookupNotFound
+		}
+		return nil, err
+	}
+	names := make([]string, len(targets))
+	for i := range targets {
+		names[i] = targets[i].String()
+	}
+	return names, nil
+}
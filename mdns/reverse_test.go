@@ -0,0 +1,60 @@
+package mdns_test
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/ironiridis/klonderoo/mdns"
+)
+
+func TestReverseName(t *testing.T) {
+	tab := []struct {
+		addr string
+		name string
+	}{
+		{"192.168.1.20", "20.1.168.192.in-addr.arpa."},
+		{"::ffff:10.0.0.1", "1.0.0.10.in-addr.arpa."},
+		{"fe80::1", "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.e.f.ip6.arpa."},
+	}
+	for _, try := range tab {
+		r := mdns.ReverseName(netip.MustParseAddr(try.addr))
+		if r != try.name {
+			t.Errorf("ReverseName(%s) should have returned %q, but returned %q", try.addr, try.name, r)
+		}
+		s := &mdns.Subject{}
+		if e := s.FromString(r); e != nil {
+			t.Errorf("Subject.FromString(ReverseName(%s)) returned %+v", try.addr, e)
+		}
+	}
+}
+
+func TestLookupAddr(t *testing.T) {
+	vn := &mdns.VirtualNetwork{}
+	rs := virtualHost(t, vn, "hall.local.", net.IPv4(10, 0, 0, 30))
+	err := rs.Publish(mdns.Record{
+		Subject: mustSubject(t, mdns.ReverseName(netip.MustParseAddr("10.0.0.30"))),
+		Type:    mdns.RecordTypePTR,
+		Class:   0x8001,
+		TTL:     120,
+		Value:   &mdns.RecordPTR{Name: *mustSubject(t, "hall.local.")},
+	})
+	if err != nil {
+		t.Fatalf("Responder.Publish returned %+v", err)
+	}
+
+	r := &mdns.Resolver{Transport: vn, Timeout: time.Second}
+	names, err := r.LookupAddr(context.Background(), netip.MustParseAddr("10.0.0.30"))
+	if err != nil {
+		t.Fatalf("Resolver.LookupAddr returned %+v", err)
+	}
+	if len(names) != 1 || names[0] != "hall.local." {
+		t.Errorf("Resolver.LookupAddr returned %v", names)
+	}
+
+	if _, err := r.LookupAddr(context.Background(), netip.MustParseAddr("10.0.0.31")); err == nil {
+		t.Errorf("Resolver.LookupAddr of an address nobody has succeeded")
+	}
+}
@@ -0,0 +1,86 @@
+package mdns
+
+import "net"
+
+// SocketOptions controls how the sockets used for mDNS are set up. The
+// defaults from DefaultSocketOptions let this package share the mDNS port
+// with a system responder such as avahi-daemon or systemd-resolved.
+type SocketOptions struct {
+	// ReuseAddr and ReusePort set SO_REUSEADDR and SO_REUSEPORT, allowing
+	// other sockets (usually the system responder's) to bind the mDNS port
+	// too. Platforms that lack SO_REUSEPORT ignore it.
+	ReuseAddr bool
+	ReusePort bool
+
+	// Loopback sets IP_MULTICAST_LOOP, which delivers our own multicasts to
+	// other sockets on this host. Without it, a responder running on the
+	// same host never hears our queries.
+	Loopback bool
+
+	// MulticastTTL is the IP TTL of multicasts we send. RFC 6762 sec 11 asks
+	// for 255.
+	MulticastTTL int
+
+	// ReadBuffer is the size of the socket's receive buffer in bytes. It
+	// needs to hold every response that can arrive in a burst while the
+	// reader is busy.
+	ReadBuffer int
+
+	// Strict has unicast packets sent with an IP TTL of 255 as well, and the
+	// TTL of each received packet reported, as strict mode needs. Listening
+	// fails with StrictModeUnsupported where the platform can't report TTLs.
+	Strict bool
+}
+
+// DefaultSocketOptions returns the options used when none are given.
+func DefaultSocketOptions() SocketOptions {
+	return SocketOptions{
+		ReuseAddr:    true,
+		ReusePort:    true,
+		Loopback:     true,
+		MulticastTTL: 255,
+		ReadBuffer:   256 * 1024,
+	}
+}
+
+// mDNSGroup is the IPv4 mDNS multicast group and port.
+var mDNSGroup = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// listenMulticast opens a socket on the mDNS port set up according to opts,
+// joined to the mDNS group on ifc (or an OS-chosen interface if nil).
+// Multicasts written to it leave via the same interface.
+func listenMulticast(ifc *net.Interface, opts SocketOptions) (*net.UDPConn, *net.UDPAddr, error) {
+	addr := &net.UDPAddr{IP: mDNSGroup.IP, Port: mDNSGroup.Port}
+	conn, err := listenGroup(ifc, addr, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if opts.ReadBuffer > 0 {
+		conn.SetReadBuffer(opts.ReadBuffer)
+	}
+	return conn, addr, nil
+}
+
+// interfaceIPv4 returns the first IPv4 address of ifc, which is how the
+// socket options for IPv4 multicast identify an interface. A nil ifc (or one
+// with no IPv4 address) yields the unspecified address, leaving the choice to
+// the OS.
+func interfaceIPv4(ifc *net.Interface) [4]byte {
+	var a [4]byte
+	if ifc == nil {
+		return a
+	}
+	addrs, err := ifc.Addrs()
+	if err != nil {
+		return a
+	}
+	for _, ad := range addrs {
+		if n, ok := ad.(*net.IPNet); ok {
+			if ip4 := n.IP.To4(); ip4 != nil {
+				copy(a[:], ip4)
+				return a
+			}
+		}
+	}
+	return a
+}
@@ -0,0 +1,11 @@
+package mdns
+
+import "syscall"
+
+const soReusePort = syscall.SO_REUSEPORT
+
+// setMulticastOpt sets one of the IP_MULTICAST_* options, which the BSDs take
+// as a single byte.
+func setMulticastOpt(fd, opt, v int) error {
+	return syscall.SetsockoptByte(fd, syscall.IPPROTO_IP, opt, byte(v))
+}
@@ -0,0 +1,9 @@
+package mdns
+
+import "syscall"
+
+// setMulticastOpt sets one of the IP_MULTICAST_* options, which Linux takes
+// as an int.
+func setMulticastOpt(fd, opt, v int) error {
+	return syscall.SetsockoptInt(fd, syscall.IPPROTO_IP, opt, v)
+}
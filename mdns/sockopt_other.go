@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+
+package mdns
+
+import "net"
+
+// listenGroup falls back to net.ListenMulticastUDP where we don't know how to
+// set the socket options ourselves; only opts.ReadBuffer is honored.
+func listenGroup(ifc *net.Interface, group *net.UDPAddr, opts SocketOptions) (*net.UDPConn, error) {
+	return net.ListenMulticastUDP("udp4", ifc, group)
+}
@@ -0,0 +1,80 @@
+//go:build linux || darwin
+
+package mdns
+
+import (
+	"context"
+	"net"
+	"syscall"
+	"testing"
+)
+
+// sockopt reads an integer socket option from the socket behind conn.
+func sockopt(t *testing.T, conn *net.UDPConn, level, opt int) int {
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		t.Fatalf("SyscallConn returned %+v", err)
+	}
+	var v int
+	rc.Control(func(fd uintptr) {
+		v, err = syscall.GetsockoptInt(int(fd), level, opt)
+	})
+	if err != nil {
+		t.Fatalf("GetsockoptInt(%d, %d) returned %+v", level, opt, err)
+	}
+	return v
+}
+
+func TestDefaultSocketOptions(t *testing.T) {
+	opts := DefaultSocketOptions()
+	lc := net.ListenConfig{Control: func(network, address string, c syscall.RawConn) error {
+		var serr error
+		err := c.Control(func(fd uintptr) {
+			serr = setSocketOptions(int(fd), opts)
+		})
+		if err != nil {
+			return err
+		}
+		return serr
+	}}
+	pc, err := lc.ListenPacket(context.Background(), "udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket returned %+v", err)
+	}
+	conn := pc.(*net.UDPConn)
+	defer conn.Close()
+
+	for _, try := range []struct {
+		name       string
+		level, opt int
+		want       int
+	}{
+		{"SO_REUSEADDR", syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1},
+		{"SO_REUSEPORT", syscall.SOL_SOCKET, soReusePort, 1},
+		{"IP_MULTICAST_LOOP", syscall.IPPROTO_IP, syscall.IP_MULTICAST_LOOP, 1},
+		{"IP_MULTICAST_TTL", syscall.IPPROTO_IP, syscall.IP_MULTICAST_TTL, opts.MulticastTTL},
+	} {
+		// the BSDs keep the multicast options in a byte
+		if v := sockopt(t, conn, try.level, try.opt); v&0xff != try.want {
+			t.Errorf("%s is %d, expected %d", try.name, v, try.want)
+		}
+	}
+}
+
+func TestSocketOptionsReadBuffer(t *testing.T) {
+	var sizes []int
+	for _, rb := range []int{16 * 1024, 128 * 1024} {
+		opts := DefaultSocketOptions()
+		opts.ReadBuffer = rb
+		conn, _, err := listenMulticast(nil, opts)
+		if err != nil {
+			t.Skipf("cannot join the mDNS group here: %+v", err)
+		}
+		sizes = append(sizes, sockopt(t, conn, syscall.SOL_SOCKET, syscall.SO_RCVBUF))
+		conn.Close()
+	}
+	// the OS may round, double or cap what is asked for, but not ignore it
+	if sizes[0] < 16*1024 || sizes[1] <= sizes[0] {
+		t.Errorf("asking for read buffers of 16KiB and 128KiB gave %d and %d bytes", sizes[0], sizes[1])
+	}
+}
@@ -0,0 +1,82 @@
+//go:build linux || darwin
+
+package mdns
+
+import (
+	"context"
+	"net"
+	"syscall"
+)
+
+// listenGroup binds the group address (so that unrelated multicast traffic
+// to the same port is not delivered to us) and joins the group, applying opts
+// along the way.
+func listenGroup(ifc *net.Interface, group *net.UDPAddr, opts SocketOptions) (*net.UDPConn, error) {
+	lc := net.ListenConfig{Control: func(network, address string, c syscall.RawConn) error {
+		var serr error
+		err := c.Control(func(fd uintptr) {
+			serr = setSocketOptions(int(fd), opts)
+		})
+		if err != nil {
+			return err
+		}
+		return serr
+	}}
+	pc, err := lc.ListenPacket(context.Background(), "udp4", group.String())
+	if err != nil {
+		return nil, err
+	}
+	conn := pc.(*net.UDPConn)
+
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	var serr error
+	err = rc.Control(func(fd uintptr) {
+		ifaddr := interfaceIPv4(ifc)
+		mreq := &syscall.IPMreq{Interface: ifaddr}
+		copy(mreq.Multiaddr[:], group.IP.To4())
+		serr = syscall.SetsockoptIPMreq(int(fd), syscall.IPPROTO_IP, syscall.IP_ADD_MEMBERSHIP, mreq)
+		if serr == nil && ifc != nil {
+			serr = syscall.SetsockoptInet4Addr(int(fd), syscall.IPPROTO_IP, syscall.IP_MULTICAST_IF, ifaddr)
+		}
+	})
+	if err == nil {
+		err = serr
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func setSocketOptions(fd int, opts SocketOptions) error {
+	err := syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_REUSEADDR, boolInt(opts.ReuseAddr))
+	if err != nil {
+		return err
+	}
+	if opts.ReusePort {
+		err = syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, soReusePort, 1)
+		if err != nil {
+			return err
+		}
+	}
+	err = setMulticastOpt(fd, syscall.IP_MULTICAST_LOOP, boolInt(opts.Loopback))
+	if err != nil {
+		return err
+	}
+	if opts.MulticastTTL > 0 {
+		err = setMulticastOpt(fd, syscall.IP_MULTICAST_TTL, opts.MulticastTTL)
+	}
+	return err
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
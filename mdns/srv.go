@@ -0,0 +1,279 @@
+package mdns
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// OrderSRV returns recs in the order a client should try them, as described in
+// RFC 2782: lowest Priority first, and within a priority, a weighted random
+// shuffle where a record's chance of coming next is proportional to its
+// Weight. recs itself is not modified.
+func OrderSRV(recs []*RecordSRV) []*RecordSRV {
+	return orderSRV(recs, rand.Intn)
+}
+
+func orderSRV(recs []*RecordSRV, intn func(int) int) []*RecordSRV {
+	sorted := make([]*RecordSRV, len(recs))
+	copy(sorted, recs)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Priority < sorted[j].Priority
+	})
+
+	out := make([]*RecordSRV, 0, len(sorted))
+	for len(sorted) > 0 {
+		n := 1
+		for n < len(sorted) && sorted[n].Priority == sorted[0].Priority {
+			n++
+		}
+		out = append(out, weightedShuffle(sorted[:n], intn)...)
+		sorted = sorted[n:]
+	}
+	return out
+}
+
+// weightedShuffle implements the selection loop from RFC 2782 for a single
+// priority. Zero-weight records are placed first so that, as the RFC asks,
+// they have a very small chance of being picked ahead of weighted ones.
+func weightedShuffle(set []*RecordSRV, intn func(int) int) []*RecordSRV {
+	pool := make([]*RecordSRV, 0, len(set))
+	for _, s := range set {
+		if s.Weight == 0 {
+			pool = append(pool, s)
+		}
+	}
+	for _, s := range set {
+		if s.Weight != 0 {
+			pool = append(pool, s)
+		}
+	}
+
+	out := make([]*RecordSRV, 0, len(pool))
+	for len(pool) > 0 {
+		sum := 0
+		for _, s := range pool {
+			sum += int(s.Weight)
+		}
+		pick := intn(sum + 1)
+		i, run := 0, 0
+		for ; i < len(pool)-1; i++ {
+			run += int(pool[i].Weight)
+			if run >= pick {
+				break
+			}
+		}
+		out = append(out, pool[i])
+		pool = append(pool[:i], pool[i+1:]...)
+	}
+	return out
+}
+
+// serviceName qualifies serviceType with the Resolver's domain if it has
+// none. A service type is two labels, "_service._proto", so anything beyond
+// those is taken to be a domain.
+func (r *Resolver) serviceName(serviceType string) string {
+	serviceType = strings.TrimSuffix(serviceType, ".")
+	if strings.Count(serviceType, ".") < 2 {
+		serviceType += "." + strings.TrimSuffix(r.domain(), ".")
+	}
+	return serviceType + "."
+}
+
+// Browse looks for instances of serviceType, such as "_ipp._tcp.local.", and
+// returns their full names. The Resolver's Domain (normally .local) is assumed
+// if serviceType omits one.
+func (r *Resolver) Browse(ctx context.Context, serviceType string) ([]string, error) {
+	name := r.serviceName(serviceType)
+	return r.browse(ctx, name)
+}
+
+// BrowseDomains asks which domains are recommended for browsing within
+// domain, using the b._dns-sd._udp query from RFC 6763 sec 11. If domain is
+// empty the Resolver's Domain is used.
+func (r *Resolver) BrowseDomains(ctx context.Context, domain string) ([]string, error) {
+	if domain == "" {
+		domain = r.domain()
+	}
+	return r.browse(ctx, "b._dns-sd._udp."+strings.TrimSuffix(domain, ".")+".")
+}
+
+// browse returns the targets of the PTR records for name.
+func (r *Resolver) browse(ctx context.Context, name string) ([]string, error) {
+	targets, err := r.browseSubjects(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	insts := make([]string, len(targets))
+	for i := range targets {
+		insts[i] = targets[i].String()
+	}
+	return insts, nil
+}
+
+// browseSubjects is browse, but keeps the targets as Subjects, since their
+// first label (an instance name) may hold dots.
+func (r *Resolver) browseSubjects(ctx context.Context, name string) ([]*Subject, error) {
+	s := &Subject{}
+	err := s.FromString(name)
+	if err != nil {
+		return nil, err
+	}
+	recs, err := r.query(ctx, s, RecordTypePTR)
+	targets := ptrTargets(recs, s)
+	if len(targets) == 0 {
+		if err == nil {
+			err = LookupNotFound
+		}
+		return nil, err
+	}
+	return targets, nil
+}
+
+// ptrTargets returns the distinct names the PTR records for s in recs point
+// to.
+func ptrTargets(recs []Record, s *Subject) []*Subject {
+	var targets []*Subject
+	seen := map[string]bool{}
+	for i := range recs {
+		ptr, ok := recs[i].Value.(*RecordPTR)
+		if !ok || !recs[i].Subject.equalFold(s) {
+			continue
+		}
+		k := strings.ToLower(string(ptr.Name.s))
+		if !seen[k] {
+			seen[k] = true
+			targets = append(targets, &ptr.Name)
+		}
+	}
+	return targets
+}
+
+// instanceSubject builds the name of instance within the service named
+// service. An instance name is a single label whatever it holds, dots
+// included (RFC 6763 sec 4.3), so it can't go through FromString.
+func instanceSubject(instance, service string) (*Subject, error) {
+	if len(instance) == 0 {
+		return nil, IllegalHostnameLabelEmpty
+	}
+	if len(instance) > 63 {
+		return nil, IllegalHostnameLabelTooLong
+	}
+	svc := &Subject{}
+	err := svc.FromString(service)
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, 0, 1+len(instance)+len(svc.s))
+	b = append(b, byte(len(instance)))
+	b = append(b, instance...)
+	b = append(b, svc.s...)
+	if len(b) > maxNameLength {
+		return nil, IllegalHostnameTooLong
+	}
+	return &Subject{s: b}, nil
+}
+
+// srvFrom picks the SRV records for s out of recs, leaving out any heard
+// more than once.
+func srvFrom(recs []Record, s *Subject) []*RecordSRV {
+	var srvs []*RecordSRV
+	seen := map[string]bool{}
+	for i := range recs {
+		srv, ok := recs[i].Value.(*RecordSRV)
+		if !ok || !recs[i].Subject.equalFold(s) {
+			continue
+		}
+		if k := recordKey(&recs[i]); !seen[k] {
+			seen[k] = true
+			srvs = append(srvs, srv)
+		}
+	}
+	return srvs
+}
+
+// LookupSRV returns the SRV records advertised for a service, in the order
+// given by OrderSRV. If instance is empty, every instance of serviceType that
+// can be found is included; otherwise only the named instance is resolved.
+// Any address records that responders volunteered alongside are returned too,
+// so that callers need not look the targets up again.
+func (r *Resolver) LookupSRV(ctx context.Context, serviceType, instance string) ([]*RecordSRV, []Record, error) {
+	var insts []*Subject
+	var err error
+	if instance == "" {
+		insts, err = r.browseSubjects(ctx, r.serviceName(serviceType))
+	} else {
+		var s *Subject
+		s, err = instanceSubject(instance, r.serviceName(serviceType))
+		insts = []*Subject{s}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var srvs []*RecordSRV
+	var extra []Record
+	for _, s := range insts {
+		recs, e := r.query(ctx, s, RecordTypeSRV)
+		found := srvFrom(recs, s)
+		if len(found) == 0 {
+			if err == nil {
+				err = e
+			}
+			continue
+		}
+		srvs = append(srvs, found...)
+		extra = append(extra, recs...)
+	}
+	if len(srvs) == 0 {
+		if err == nil {
+			err = LookupNotFound
+		}
+		return nil, nil, err
+	}
+	return OrderSRV(srvs), extra, nil
+}
+
+// DialService resolves a DNS-SD service and connects to it, trying each SRV
+// target in the order given by OrderSRV until one accepts. The network ("tcp"
+// or "udp") is taken from the protocol label of serviceType. If instance is
+// empty, any instance of the service will do.
+func (r *Resolver) DialService(ctx context.Context, serviceType, instance string) (net.Conn, error) {
+	network := "tcp"
+	if strings.Contains(strings.ToLower(serviceType), "._udp") {
+		network = "udp"
+	}
+
+	srvs, extra, err := r.LookupSRV(ctx, serviceType, instance)
+	if err != nil {
+		return nil, err
+	}
+
+	var first error
+	for _, srv := range srvs {
+		addrs := addrsFrom(extra, &srv.Target)
+		if len(addrs) == 0 {
+			addrs, err = r.LookupIP(ctx, srv.Target.String())
+			if err != nil {
+				if first == nil {
+					first = err
+				}
+				continue
+			}
+		}
+		c, err := dialAddrs(ctx, network, r.zoned(addrs), strconv.Itoa(int(srv.Port)))
+		if err == nil {
+			return c, nil
+		}
+		if first == nil {
+			first = err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, first
+}
@@ -0,0 +1,145 @@
+package mdns_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ironiridis/klonderoo/mdns"
+)
+
+func TestOrderSRVPriority(t *testing.T) {
+	in := []*mdns.RecordSRV{
+		{Priority: 20, Weight: 5, Port: 1},
+		{Priority: 10, Weight: 0, Port: 2},
+		{Priority: 30, Weight: 1, Port: 3},
+		{Priority: 10, Weight: 60, Port: 4},
+		{Priority: 20, Weight: 0, Port: 5},
+	}
+	for try := 0; try < 100; try++ {
+		out := mdns.OrderSRV(in)
+		if len(out) != len(in) {
+			t.Fatalf("OrderSRV returned %d records, expected %d", len(out), len(in))
+		}
+		for i := 1; i < len(out); i++ {
+			if out[i].Priority < out[i-1].Priority {
+				t.Fatalf("OrderSRV returned priority %d after %d", out[i].Priority, out[i-1].Priority)
+			}
+		}
+	}
+	if in[0].Port != 1 || in[4].Port != 5 {
+		t.Errorf("OrderSRV modified its input")
+	}
+}
+
+func TestOrderSRVWeight(t *testing.T) {
+	in := []*mdns.RecordSRV{
+		{Priority: 0, Weight: 1, Port: 1},
+		{Priority: 0, Weight: 9, Port: 2},
+	}
+	heavy := 0
+	for try := 0; try < 1000; try++ {
+		if mdns.OrderSRV(in)[0].Port == 2 {
+			heavy++
+		}
+	}
+	// RFC 2782 picks from 0 to the sum of the weights inclusive, and a pick of
+	// 0 or 1 goes to the light record, so expect around 9/11 (818); anything
+	// near an even split means weights are ignored
+	if heavy < 740 || heavy > 900 {
+		t.Errorf("OrderSRV picked the weight 9 record first %d times in 1000", heavy)
+	}
+}
+
+// printers starts a Responder on vn for printer.local. at 127.0.0.1,
+// offering "_ipp._tcp" as "Kitchen" on port 9 and, with a dot in its name, as
+// "Mr. Printer" on port.
+func printers(t *testing.T, vn *mdns.VirtualNetwork, port uint16) {
+	rs := virtualHost(t, vn, "printer.local.", net.IPv4(127, 0, 0, 1))
+	err := rs.Register(&mdns.Service{Instance: "Kitchen", Type: "_ipp._tcp", Host: "printer.local.", Port: 9})
+	if err != nil {
+		t.Fatalf("Responder.Register returned %+v", err)
+	}
+	inst := &mdns.Subject{}
+	if err := inst.UnmarshalText([]byte(`Mr\. Printer._ipp._tcp.local.`)); err != nil {
+		t.Fatalf("Subject.UnmarshalText returned %+v", err)
+	}
+	err = rs.Publish(
+		mdns.Record{Subject: mustSubject(t, "_ipp._tcp.local."), Type: mdns.RecordTypePTR, Class: 1, TTL: 4500, Value: &mdns.RecordPTR{Name: *inst}},
+		mdns.Record{Subject: inst, Type: mdns.RecordTypeSRV, Class: 0x8001, TTL: 120, Value: &mdns.RecordSRV{Port: port, Target: *mustSubject(t, "printer.local.")}},
+	)
+	if err != nil {
+		t.Fatalf("Responder.Publish returned %+v", err)
+	}
+}
+
+func TestLookupSRV(t *testing.T) {
+	vn := &mdns.VirtualNetwork{}
+	printers(t, vn, 631)
+	r := &mdns.Resolver{Transport: vn, Timeout: time.Second}
+
+	srvs, extra, err := r.LookupSRV(context.Background(), "_ipp._tcp", "")
+	if err != nil {
+		t.Fatalf("Resolver.LookupSRV of every instance returned %+v", err)
+	}
+	ports := map[uint16]bool{}
+	for _, srv := range srvs {
+		ports[srv.Port] = true
+	}
+	if len(srvs) != 2 || !ports[9] || !ports[631] {
+		t.Errorf("Resolver.LookupSRV of every instance returned %+v", srvs)
+	}
+	if len(extra) == 0 {
+		t.Errorf("Resolver.LookupSRV returned no additional records")
+	}
+
+	srvs, _, err = r.LookupSRV(context.Background(), "_ipp._tcp", "Mr. Printer")
+	if err != nil {
+		t.Fatalf("Resolver.LookupSRV of one instance returned %+v", err)
+	}
+	if len(srvs) != 1 || srvs[0].Port != 631 || srvs[0].Target.String() != "printer.local." {
+		t.Errorf("Resolver.LookupSRV of one instance returned %+v", srvs)
+	}
+
+	if _, _, err := r.LookupSRV(context.Background(), "_ipp._tcp", "Garage"); err == nil {
+		t.Errorf("Resolver.LookupSRV of a missing instance succeeded")
+	}
+}
+
+func TestDialService(t *testing.T) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen returned %+v", err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			c.Write([]byte("ipp"))
+			c.Close()
+		}
+	}()
+	vn := &mdns.VirtualNetwork{}
+	printers(t, vn, uint16(l.Addr().(*net.TCPAddr).Port))
+	r := &mdns.Resolver{Transport: vn, Timeout: time.Second}
+
+	c, err := r.DialService(context.Background(), "_ipp._tcp", "Mr. Printer")
+	if err != nil {
+		t.Fatalf("Resolver.DialService returned %+v", err)
+	}
+	buf := make([]byte, 3)
+	n, _ := c.Read(buf)
+	c.Close()
+	if string(buf[:n]) != "ipp" {
+		t.Errorf("the dialed service sent %q", buf[:n])
+	}
+
+	// Kitchen's port 9 refuses connections
+	if _, err := r.DialService(context.Background(), "_ipp._tcp", "Kitchen"); err == nil {
+		t.Errorf("Resolver.DialService to a closed port succeeded")
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !linux && !darwin
+
+package mdns
+
+import "net"
+
+const strictOOBSize = 0
+
+func enableStrict(conn *net.UDPConn) error {
+	return StrictModeUnsupported
+}
+
+func packetTTL(oob []byte) (int, bool) {
+	return 0, false
+}
@@ -0,0 +1,55 @@
+//go:build linux || darwin
+
+package mdns
+
+import (
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestEnableStrict(t *testing.T) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("ListenUDP returned %+v", err)
+	}
+	defer conn.Close()
+	err = enableStrict(conn)
+	if err != nil {
+		t.Fatalf("enableStrict returned %+v", err)
+	}
+
+	// a strict Client asks for a multicast TTL of 255 in its SocketOptions
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		t.Fatalf("SyscallConn returned %+v", err)
+	}
+	rc.Control(func(fd uintptr) {
+		err := setSocketOptions(int(fd), SocketOptions{MulticastTTL: 255})
+		if err != nil {
+			t.Fatalf("setSocketOptions returned %+v", err)
+		}
+		for _, opt := range []int{syscall.IP_MULTICAST_TTL, syscall.IP_TTL} {
+			v, err := syscall.GetsockoptInt(int(fd), syscall.IPPROTO_IP, opt)
+			if err != nil || v&0xff != 255 {
+				t.Errorf("socket option %d is %d (%v), not 255", opt, v, err)
+			}
+		}
+	})
+
+	_, err = conn.WriteToUDP([]byte("ping"), conn.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatalf("WriteToUDP returned %+v", err)
+	}
+	conn.SetDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 16)
+	oob := make([]byte, strictOOBSize)
+	_, oobn, _, _, err := conn.ReadMsgUDP(buf, oob)
+	if err != nil {
+		t.Fatalf("ReadMsgUDP returned %+v", err)
+	}
+	if ttl, ok := packetTTL(oob[:oobn]); !ok || ttl != 255 {
+		t.Errorf("packetTTL reported %d, %v for a packet sent with a TTL of 255", ttl, ok)
+	}
+}
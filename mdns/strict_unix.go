@@ -0,0 +1,65 @@
+//go:build linux || darwin
+
+package mdns
+
+import (
+	"encoding/binary"
+	"net"
+	"syscall"
+)
+
+// strictOOBSize is enough room for the control message carrying a packet's
+// TTL.
+var strictOOBSize = syscall.CmsgSpace(4)
+
+// enableStrict sets conn to send unicast packets with a TTL of 255, as RFC
+// 6762 sec 11 asks, and to report the TTL of each packet received. The
+// multicast TTL is one of the SocketOptions.
+func enableStrict(conn *net.UDPConn) error {
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var serr error
+	err = rc.Control(func(fd uintptr) {
+		for _, opt := range []int{syscall.IP_TTL, syscall.IP_RECVTTL} {
+			v := 255
+			if opt == syscall.IP_RECVTTL {
+				v = 1
+			}
+			serr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, opt, v)
+			if serr != nil {
+				return
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return serr
+}
+
+// packetTTL extracts the TTL a packet arrived with from its control messages.
+// Linux reports it as an int under IP_TTL; the BSDs as a byte under
+// IP_RECVTTL.
+func packetTTL(oob []byte) (int, bool) {
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return 0, false
+	}
+	for _, m := range msgs {
+		if m.Header.Level != syscall.IPPROTO_IP {
+			continue
+		}
+		if m.Header.Type != syscall.IP_TTL && m.Header.Type != syscall.IP_RECVTTL {
+			continue
+		}
+		switch len(m.Data) {
+		case 1:
+			return int(m.Data[0]), true
+		case 4:
+			return int(binary.NativeEndian.Uint32(m.Data)), true
+		}
+	}
+	return 0, false
+}
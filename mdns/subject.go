@@ -6,6 +6,15 @@ import (
 	"strings"
 )
 
+// maxNameLength is the longest a name may be in wire format (RFC 1035 sec
+// 2.3.4).
+const maxNameLength = 255
+
+// maxPointerHops limits how many compression pointers a name may follow. A
+// name of maxNameLength has at most 127 labels, so no legitimate name needs
+// more.
+const maxPointerHops = 127
+
 // Subject represents a DNS object, domain, or zone name, represented in the
 // length-prefixed label series format as described in RFC 1035 sec 4.1.2-3
 type Subject struct {
@@ -23,68 +32,90 @@ func (s *Subject) Encode() []byte {
 	return s.s
 }
 
-func (s *Subject) labelRead(r mDNSPacketReader) (int64, error) {
-	l := make([]byte, 1)
-	b := make([]byte, 255)
-	var n int
-	var err error
+// ReadFrom will decode a Subject by reading it from r, which must be
+// positioned at the start of the name. Compression pointers are followed by
+// reading from r at the offset they give, so offsets in r must be those of
+// the packet. If r is also an io.Seeker, as a bytes.Reader is, a pointer
+// leading anywhere but back before the name is refused; either way, no
+// pointer may lead forward from another. Code decoding whole packets uses a
+// decoder instead, which avoids copying.
+func (s *Subject) ReadFrom(r mDNSPacketReader) error {
+	own, o, err := readLabels(r)
+	if err != nil {
+		s.s = nil
+		return err
+	}
+	if o < 0 {
+		d := decoder{buf: own}
+		return d.name(s)
+	}
+	if sk, ok := r.(io.Seeker); ok {
+		pos, err := sk.Seek(0, io.SeekCurrent)
+		if err == nil && o >= pos-2 {
+			// RFC 1035 sec 4.1.4 only allows pointing at a prior occurrence
+			s.s = nil
+			return CompressionPointerForward
+		}
+	}
+	// what the pointer leads to, and any pointers from there, must lie
+	// within a name's length after it
+	buf := make([]byte, o+maxNameLength+2, o+maxNameLength+2+int64(len(own)))
+	n, err := r.ReadAt(buf, 0)
+	if n < len(buf) && err != io.EOF {
+		s.s = nil
+		return err
+	}
+	if int64(n) <= o {
+		s.s = nil
+		return io.ErrUnexpectedEOF
+	}
+	d := decoder{buf: append(buf[:n], own...), off: n}
+	return d.name(s)
+}
+
+// readLabels reads the labels of a name from r, up to and including the
+// terminating empty label or compression pointer. It also returns the offset
+// the pointer gives, or -1 if there was none.
+func readLabels(r io.Reader) ([]byte, int64, error) {
+	var own []byte
 	for {
-		n, err = r.Read(l)
+		var l [2]byte
+		_, err := io.ReadFull(r, l[:1])
 		if err != nil {
-			return -1, err
+			return nil, -1, unexpectedEOF(err)
 		}
-		if n < 1 {
-			return -1, io.ErrUnexpectedEOF
-		}
-		if l[0]&0xC0 == 0xC0 {
-			// label compression
-			p := make([]byte, 1)
-			n, err = r.Read(p)
+		switch {
+		case l[0]&0xc0 == 0xc0:
+			_, err = io.ReadFull(r, l[1:])
 			if err != nil {
-				return -1, err
-			}
-			if n != 1 {
-				return -1, io.ErrUnexpectedEOF
+				return nil, -1, unexpectedEOF(err)
 			}
-			return int64(l[0]&0x3f)<<8 | int64(p[0]), nil
-		}
-		if l[0] > 63 {
-			return -1, IllegalHostnameLabelTooLong
+			return append(own, l[:]...), int64(l[0]&0x3f)<<8 | int64(l[1]), nil
+		case l[0] > 63:
+			return nil, -1, IllegalHostnameLabelTooLong
+		case len(own)+1+int(l[0]) > maxNameLength:
+			return nil, -1, IllegalHostnameTooLong
 		}
-		s.s = append(s.s, l...)
+		own = append(own, l[0])
 		if l[0] == 0 {
-			return -1, nil
+			return own, -1, nil
 		}
-		n, err = r.Read(b[:l[0]])
+		lbl := make([]byte, l[0])
+		_, err = io.ReadFull(r, lbl)
 		if err != nil {
-			return -1, err
+			return nil, -1, unexpectedEOF(err)
 		}
-		if byte(n) < l[0] {
-			return -1, io.ErrUnexpectedEOF
-		}
-		s.s = append(s.s, b[:n]...)
+		own = append(own, lbl...)
 	}
 }
 
-// ReadFrom will decode a Subject by reading it from r
-func (s *Subject) ReadFrom(r mDNSPacketReader) error {
-	if s.s == nil {
-		s.s = make([]byte, 0, 255)
-	} else {
-		s.s = s.s[:0]
-	}
-	rdr := r
-	for {
-		o, err := s.labelRead(rdr)
-		if err != nil {
-			s.s = nil
-			return err
-		}
-		if o == -1 {
-			return nil
-		}
-		rdr = io.NewSectionReader(r, o, mDNSMaximumPacketSize)
+// unexpectedEOF turns io.EOF, which means the packet ended mid-name, into
+// io.ErrUnexpectedEOF.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
 	}
+	return err
 }
 
 // Decode will copy an already-encoded Subject in wire format
@@ -143,3 +174,11 @@ func (s *Subject) EqualTo(c *Subject) bool {
 	}
 	return bytes.Equal(s.s, c.s)
 }
+
+// equalFold is like EqualTo, but ignores ASCII case as DNS names do.
+func (s *Subject) equalFold(c *Subject) bool {
+	if s == nil || c == nil || s.s == nil || c.s == nil {
+		return false
+	}
+	return bytes.EqualFold(s.s, c.s)
+}
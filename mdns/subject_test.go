@@ -2,6 +2,7 @@ package mdns_test
 
 import (
 	"bytes"
+	"io"
 	"testing"
 
 	"github.com/ironiridis/klonderoo/mdns"
@@ -98,3 +99,51 @@ func TestSubjectWireRoundTrip(t *testing.T) {
 		}
 	}
 }
+
+// plainReader offers only the Read and ReadAt methods of a bytes.Reader, so
+// that Subject.ReadFrom can't find out where it is.
+type plainReader struct {
+	r *bytes.Reader
+}
+
+func (p plainReader) Read(b []byte) (int, error)              { return p.r.Read(b) }
+func (p plainReader) ReadAt(b []byte, off int64) (int, error) { return p.r.ReadAt(b, off) }
+
+func TestSubjectCompressionPointers(t *testing.T) {
+	tab := []struct {
+		pkt   []byte
+		at    int64
+		err   error
+		plain error // from a reader that can't say where the name starts
+		end   int64 // where the name ends, if it is read
+	}{
+		// points at itself
+		{[]byte{0xc0, 0x00}, 0, mdns.CompressionPointerForward, mdns.CompressionPointerForward, 0},
+		// points forward, which only a reader that can seek reveals
+		{[]byte{0xc0, 0x02, 0x01, 'a', 0x00}, 0, mdns.CompressionPointerForward, nil, 2},
+		// two names pointing at each other
+		{[]byte{0x01, 'a', 0xc0, 0x04, 0x01, 'b', 0xc0, 0x00}, 4, mdns.CompressionPointerForward, mdns.CompressionPointerForward, 0},
+		// a sound pointer back to an earlier name
+		{[]byte{0x01, 'a', 0x00, 0x01, 'b', 0xc0, 0x00}, 3, nil, nil, 7},
+		// a pointer past the end of the packet
+		{[]byte{0x01, 'b', 0xc0, 0x09}, 0, mdns.CompressionPointerForward, io.ErrUnexpectedEOF, 0},
+	}
+	for _, try := range tab {
+		r := bytes.NewReader(try.pkt)
+		r.Seek(try.at, 0)
+		s := &mdns.Subject{}
+		e := s.ReadFrom(r)
+		if e != try.err {
+			t.Errorf("Subject.ReadFrom(% x) should have returned %+v, but returned %+v", try.pkt, try.err, e)
+		}
+
+		r.Seek(try.at, 0)
+		e = s.ReadFrom(plainReader{r})
+		if e != try.plain {
+			t.Errorf("Subject.ReadFrom(% x) without seeking should have returned %+v, but returned %+v", try.pkt, try.plain, e)
+		}
+		if end := r.Size() - int64(r.Len()); e == nil && end != try.end {
+			t.Errorf("Subject.ReadFrom(% x) stopped reading at %d, expected %d", try.pkt, end, try.end)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package mdns
+
+import (
+	"net"
+	"time"
+)
+
+// A Transport opens the connections that mDNS traffic is carried over. The
+// default, UDPTransport, uses real multicast sockets; a VirtualNetwork
+// carries packets in memory, so that clients and responders can be tested
+// against one another without a network.
+type Transport interface {
+	// Listen returns a connection joined to the mDNS group on ifc (or an
+	// OS-chosen interface if nil), set up according to opts.
+	Listen(ifc *net.Interface, opts SocketOptions) (PacketConn, error)
+}
+
+// A PacketConn sends and receives mDNS packets. Packets written to the mDNS
+// group address are multicast; any other address gets a unicast.
+type PacketConn interface {
+	// ReadFrom reads the next packet into b. ttl is the IP TTL the packet
+	// arrived with, or -1 if it was not asked for with SocketOptions.Strict.
+	ReadFrom(b []byte) (n int, src *net.UDPAddr, ttl int, err error)
+	WriteTo(b []byte, dst *net.UDPAddr) (int, error)
+	SetDeadline(t time.Time) error
+	Close() error
+}
+
+// UDPTransport is the Transport that uses the host's network.
+type UDPTransport struct{}
+
+// Listen opens a UDP socket on the mDNS port.
+func (UDPTransport) Listen(ifc *net.Interface, opts SocketOptions) (PacketConn, error) {
+	conn, _, err := listenMulticast(ifc, opts)
+	if err != nil {
+		return nil, err
+	}
+	u := &udpConn{conn: conn}
+	if opts.Strict {
+		err = enableStrict(conn)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		u.oob = make([]byte, strictOOBSize)
+	}
+	return u, nil
+}
+
+type udpConn struct {
+	conn *net.UDPConn
+	oob  []byte // control messages, if TTLs were asked for
+}
+
+func (u *udpConn) ReadFrom(b []byte) (int, *net.UDPAddr, int, error) {
+	if u.oob == nil {
+		n, src, err := u.conn.ReadFromUDP(b)
+		return n, src, -1, err
+	}
+	n, oobn, _, src, err := u.conn.ReadMsgUDP(b, u.oob)
+	if err != nil {
+		return n, src, -1, err
+	}
+	ttl, ok := packetTTL(u.oob[:oobn])
+	if !ok {
+		ttl = -1
+	}
+	return n, src, ttl, nil
+}
+
+func (u *udpConn) WriteTo(b []byte, dst *net.UDPAddr) (int, error) {
+	return u.conn.WriteToUDP(b, dst)
+}
+
+func (u *udpConn) SetDeadline(t time.Time) error {
+	return u.conn.SetDeadline(t)
+}
+
+func (u *udpConn) Close() error {
+	return u.conn.Close()
+}
+
+// transportOrDefault returns t, or UDPTransport if t is nil.
+func transportOrDefault(t Transport) Transport {
+	if t == nil {
+		return UDPTransport{}
+	}
+	return t
+}
@@ -0,0 +1,101 @@
+package mdns
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net"
+	"time"
+)
+
+// unicastQuery asks the Resolver's Server q over UDP, retrying over TCP if
+// the reply comes back truncated, and returns every record in the reply. A
+// name error from the server is reported as LookupNotFound.
+func (r *Resolver) unicastQuery(ctx context.Context, q *Question) ([]Record, error) {
+	q.TransactionID = uint16(rand.Intn(0x10000))
+	q.Flags = flagRecursionDesired
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout(ctx))
+	defer cancel()
+
+	m, err := unicastExchange(ctx, "udp", r.Server, q)
+	if err == nil && m.Flags&flagTruncated != 0 {
+		m, err = unicastExchange(ctx, "tcp", r.Server, q)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	recs := make([]Record, 0, len(m.Answer)+len(m.Authority)+len(m.Additional))
+	recs = append(recs, m.Answer...)
+	recs = append(recs, m.Authority...)
+	recs = append(recs, m.Additional...)
+	err = rcodeError(m.Flags)
+	if err == ResponseCodeNameError {
+		err = LookupNotFound
+	}
+	return recs, err
+}
+
+// unicastExchange sends q to server over network ("udp" or "tcp") and waits
+// for the matching reply.
+func unicastExchange(ctx context.Context, network, server string, q *Question) (*Message, error) {
+	var d net.Dialer
+	c, err := d.DialContext(ctx, network, server)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	if dl, ok := ctx.Deadline(); ok {
+		c.SetDeadline(dl)
+	}
+	stop := context.AfterFunc(ctx, func() { c.SetDeadline(time.Now()) })
+	defer stop()
+
+	out := q.Encode()
+	if network == "tcp" {
+		out = append(uint16ToWire(uint16(len(out))), out...)
+	}
+	_, err = c.Write(out)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, mDNSMaximumPacketSize)
+	for {
+		var n int
+		if network == "tcp" {
+			var l uint16
+			l, err = readUint16(c)
+			if err != nil {
+				return nil, err
+			}
+			buf = make([]byte, l)
+			n, err = io.ReadFull(c, buf)
+		} else {
+			n, err = c.Read(buf)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		m := &Message{}
+		err = m.Decode(buf[:n], 1000)
+		if err != nil && network == "tcp" {
+			return nil, err
+		}
+		if err != nil {
+			// a truncated reply may be cut short mid-record; the header is
+			// still enough to know that we should retry over TCP
+			if n < 4 || wireToUint16(buf[2:4])&flagTruncated == 0 {
+				continue
+			}
+			m = &Message{ID: wireToUint16(buf[0:2]), Flags: wireToUint16(buf[2:4])}
+		}
+		if m.ID != q.TransactionID || m.Flags&flagResponse == 0 {
+			// a stray or spoofed datagram; keep waiting for ours
+			continue
+		}
+		return m, nil
+	}
+}
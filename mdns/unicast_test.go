@@ -0,0 +1,137 @@
+package mdns_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ironiridis/klonderoo/mdns"
+)
+
+// serveBridge starts a Bridge on loopback over UDP and TCP, answering from
+// recs, and returns its address.
+func serveBridge(t *testing.T, ctx context.Context, recs standIn) string {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", pc.LocalAddr().String())
+	if err != nil {
+		pc.Close()
+		t.Skipf("cannot listen on TCP alongside UDP: %+v", err)
+	}
+	b := &mdns.Bridge{Querier: recs}
+	go b.ServeUDP(ctx, pc)
+	go b.ServeTCP(ctx, l)
+	return pc.LocalAddr().String()
+}
+
+func TestUnicastBrowse(t *testing.T) {
+	svc := mustSubject(t, "_ipp._tcp.local.")
+	domains := mustSubject(t, "b._dns-sd._udp.local.")
+	recs := standIn{
+		"b._dns-sd._udp.local.": {{Subject: domains, Type: mdns.RecordTypePTR, Class: 1, TTL: 3600, Value: &mdns.RecordPTR{Name: *mustSubject(t, "local.")}}},
+	}
+	// enough instances that the UDP reply is truncated and TCP is needed
+	for i := 0; i < 40; i++ {
+		n := *mustSubject(t, fmt.Sprintf("Printer %d._ipp._tcp.local.", i))
+		recs["_ipp._tcp.local."] = append(recs["_ipp._tcp.local."], mdns.Record{Subject: svc, Type: mdns.RecordTypePTR, Class: 1, TTL: 120, Value: &mdns.RecordPTR{Name: n}})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	r := &mdns.Resolver{Server: serveBridge(t, ctx, recs)}
+
+	insts, err := r.Browse(ctx, "_ipp._tcp")
+	if err != nil {
+		t.Fatalf("Resolver.Browse returned %+v", err)
+	}
+	if len(insts) != 40 {
+		t.Errorf("Resolver.Browse returned %d instances, expected 40", len(insts))
+	}
+
+	doms, err := r.BrowseDomains(ctx, "")
+	if err != nil {
+		t.Fatalf("Resolver.BrowseDomains returned %+v", err)
+	}
+	if len(doms) != 1 || doms[0] != "local." {
+		t.Errorf("Resolver.BrowseDomains returned %q, expected [\"local.\"]", doms)
+	}
+
+	_, err = r.Browse(ctx, "_scanner._tcp")
+	if err != mdns.LookupNotFound {
+		t.Errorf("Resolver.Browse of a missing service returned %+v, expected %+v", err, mdns.LookupNotFound)
+	}
+}
+
+// splitServer answers every query over UDP truncated, and over TCP in full
+// with a record for printer.local., sending the length prefix a byte at a time.
+// It returns its address.
+func splitServer(t *testing.T) string {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	l, err := net.Listen("tcp", pc.LocalAddr().String())
+	if err != nil {
+		t.Skipf("cannot listen on TCP alongside UDP: %+v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		buf := make([]byte, mdns.MaximumPacketSize)
+		for {
+			n, from, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			q := &mdns.Message{}
+			if q.Decode(buf[:n], 10) == nil {
+				pc.WriteTo((&mdns.Message{ID: q.ID, Flags: 0x8200}).Encode(), from)
+			}
+		}
+	}()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			pre := make([]byte, 2)
+			if _, err = io.ReadFull(c, pre); err != nil {
+				c.Close()
+				continue
+			}
+			buf := make([]byte, int(pre[0])<<8|int(pre[1]))
+			io.ReadFull(c, buf)
+			q := &mdns.Message{}
+			if q.Decode(buf, 10) != nil {
+				c.Close()
+				continue
+			}
+			b := (&mdns.Message{ID: q.ID, Flags: 0x8400, Answer: []mdns.Record{
+				{Subject: q.Questions[0].Subject, Type: mdns.RecordTypeA, Class: 1, TTL: 120, Value: &mdns.RecordA{Addr: net.IPv4(192, 168, 1, 20)}},
+			}}).Encode()
+			c.Write([]byte{byte(len(b) >> 8)})
+			time.Sleep(50 * time.Millisecond)
+			c.Write(append([]byte{byte(len(b))}, b...))
+			c.Close()
+		}
+	}()
+	return pc.LocalAddr().String()
+}
+
+func TestUnicastTCPSplitLength(t *testing.T) {
+	r := &mdns.Resolver{Server: splitServer(t), Timeout: 2 * time.Second}
+	recs, err := r.Query(context.Background(), "printer.local.", mdns.RecordTypeA)
+	if err != nil {
+		t.Fatalf("Resolver.Query over TCP with a split length prefix returned %+v", err)
+	}
+	if len(recs) != 1 {
+		t.Errorf("Resolver.Query returned %d records, expected 1", len(recs))
+	}
+}
@@ -0,0 +1,173 @@
+package mdns
+
+import (
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// virtualQueueLength is how many packets a virtual connection holds unread
+// before further ones are dropped, as a full socket buffer would.
+const virtualQueueLength = 256
+
+// A VirtualNetwork is a Transport that carries packets between its
+// connections in memory, as though each were a separate host on one link.
+// Every connection is given its own link-local address on port 5353, and
+// packets arrive with a TTL of 255, so strict mode is satisfied. The
+// interface passed to Listen is ignored. The zero value is ready to use.
+type VirtualNetwork struct {
+	mu    sync.Mutex
+	conns []*virtualConn
+	hosts int
+}
+
+// Listen connects a new host to the network.
+func (vn *VirtualNetwork) Listen(ifc *net.Interface, opts SocketOptions) (PacketConn, error) {
+	vn.mu.Lock()
+	defer vn.mu.Unlock()
+	vn.hosts++
+	c := &virtualConn{
+		vn:   vn,
+		addr: &net.UDPAddr{IP: net.IPv4(169, 254, byte(vn.hosts>>8), byte(vn.hosts)), Port: mDNSGroup.Port},
+		loop: opts.Loopback,
+		ttl:  -1,
+		in:   make(chan virtualPacket, virtualQueueLength),
+		kick: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	if opts.Strict {
+		c.ttl = 255
+	}
+	vn.conns = append(vn.conns, c)
+	return c, nil
+}
+
+// Addrs returns the address of each host currently on the network.
+func (vn *VirtualNetwork) Addrs() []*net.UDPAddr {
+	vn.mu.Lock()
+	defer vn.mu.Unlock()
+	addrs := make([]*net.UDPAddr, len(vn.conns))
+	for i, c := range vn.conns {
+		addrs[i] = c.addr
+	}
+	return addrs
+}
+
+// deliver hands a copy of b from src to dst, or to every host if dst is the
+// mDNS group.
+func (vn *VirtualNetwork) deliver(b []byte, src *virtualConn, dst *net.UDPAddr) {
+	p := virtualPacket{data: append([]byte(nil), b...), src: src.addr}
+	multicast := dst.IP.Equal(mDNSGroup.IP)
+
+	vn.mu.Lock()
+	defer vn.mu.Unlock()
+	for _, c := range vn.conns {
+		switch {
+		case multicast:
+			if c == src && !c.loop {
+				continue
+			}
+		case !c.addr.IP.Equal(dst.IP) || c.addr.Port != dst.Port:
+			continue
+		}
+		select {
+		case c.in <- p:
+		default:
+		}
+	}
+}
+
+func (vn *VirtualNetwork) remove(c *virtualConn) {
+	vn.mu.Lock()
+	defer vn.mu.Unlock()
+	for i := range vn.conns {
+		if vn.conns[i] == c {
+			vn.conns = append(vn.conns[:i], vn.conns[i+1:]...)
+			return
+		}
+	}
+}
+
+type virtualPacket struct {
+	data []byte
+	src  *net.UDPAddr
+}
+
+type virtualConn struct {
+	vn   *VirtualNetwork
+	addr *net.UDPAddr
+	loop bool
+	ttl  int
+	in   chan virtualPacket
+
+	mu       sync.Mutex
+	deadline time.Time
+	kick     chan struct{} // closed when the deadline changes
+	done     chan struct{}
+	once     sync.Once
+}
+
+func (c *virtualConn) ReadFrom(b []byte) (int, *net.UDPAddr, int, error) {
+	for {
+		c.mu.Lock()
+		deadline, kick := c.deadline, c.kick
+		c.mu.Unlock()
+
+		var t *time.Timer
+		var expired <-chan time.Time
+		if !deadline.IsZero() {
+			d := time.Until(deadline)
+			if d <= 0 {
+				return 0, nil, -1, os.ErrDeadlineExceeded
+			}
+			t = time.NewTimer(d)
+			expired = t.C
+		}
+		select {
+		case p := <-c.in:
+			stopTimer(t)
+			return copy(b, p.data), p.src, c.ttl, nil
+		case <-c.done:
+			stopTimer(t)
+			return 0, nil, -1, net.ErrClosed
+		case <-expired:
+			return 0, nil, -1, os.ErrDeadlineExceeded
+		case <-kick:
+			stopTimer(t)
+		}
+	}
+}
+
+func stopTimer(t *time.Timer) {
+	if t != nil {
+		t.Stop()
+	}
+}
+
+func (c *virtualConn) WriteTo(b []byte, dst *net.UDPAddr) (int, error) {
+	select {
+	case <-c.done:
+		return 0, net.ErrClosed
+	default:
+	}
+	c.vn.deliver(b, c, dst)
+	return len(b), nil
+}
+
+func (c *virtualConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.deadline = t
+	close(c.kick)
+	c.kick = make(chan struct{})
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *virtualConn) Close() error {
+	c.once.Do(func() {
+		close(c.done)
+		c.vn.remove(c)
+	})
+	return nil
+}
@@ -0,0 +1,125 @@
+package mdns_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/ironiridis/klonderoo/mdns"
+)
+
+// virtualHost starts a Responder on vn publishing an A record for name.
+func virtualHost(t *testing.T, vn *mdns.VirtualNetwork, name string, ip net.IP) *mdns.Responder {
+	rs, err := mdns.NewResponderTransport(vn, nil)
+	if err != nil {
+		t.Fatalf("NewResponderTransport returned %+v", err)
+	}
+	t.Cleanup(func() { rs.Close() })
+	err = rs.Publish(mdns.Record{
+		Subject: mustSubject(t, name),
+		Type:    mdns.RecordTypeA,
+		Class:   0x8001,
+		TTL:     120,
+		Value:   &mdns.RecordA{Addr: ip},
+	})
+	if err != nil {
+		t.Fatalf("Responder.Publish returned %+v", err)
+	}
+	return rs
+}
+
+func TestVirtualClient(t *testing.T) {
+	vn := &mdns.VirtualNetwork{}
+	virtualHost(t, vn, "kitchen.local.", net.IPv4(10, 0, 0, 7))
+
+	for _, strict := range []bool{false, true} {
+		c, err := mdns.NewClient("kitchen.local.", mdns.RecordTypeA)
+		if err != nil {
+			t.Fatalf("NewClient returned %+v", err)
+		}
+		c.SetTransport(vn)
+		c.SetStrict(strict)
+		c.SetTimeout(time.Second)
+		ch, err := c.Run()
+		if err != nil {
+			t.Fatalf("Client.Run (strict %v) returned %+v", strict, err)
+		}
+		found := false
+		for r := range ch {
+			for _, rec := range r.Answer {
+				if a, ok := rec.Value.(*mdns.RecordA); ok && a.Addr.Equal(net.IPv4(10, 0, 0, 7)) {
+					found = true
+				}
+			}
+			r.Release()
+			if found {
+				c.Close()
+			}
+		}
+		if !found {
+			t.Errorf("Client (strict %v) never heard the A record", strict)
+		}
+	}
+}
+
+func TestVirtualResolver(t *testing.T) {
+	vn := &mdns.VirtualNetwork{}
+	virtualHost(t, vn, "hall.local.", net.IPv4(10, 0, 0, 8))
+	virtualHost(t, vn, "den.local.", net.IPv4(10, 0, 0, 9))
+
+	r := &mdns.Resolver{Transport: vn, Timeout: time.Second}
+	addrs, err := r.LookupIP(context.Background(), "den.local.")
+	if err != nil {
+		t.Fatalf("Resolver.LookupIP returned %+v", err)
+	}
+	if len(addrs) != 1 || addrs[0] != netip.MustParseAddr("10.0.0.9") {
+		t.Errorf("Resolver.LookupIP returned %v", addrs)
+	}
+
+	_, err = r.LookupIP(context.Background(), "attic.local.")
+	if err == nil {
+		t.Errorf("Resolver.LookupIP of a name nobody has succeeded")
+	}
+}
+
+func TestVirtualMalformed(t *testing.T) {
+	vn := &mdns.VirtualNetwork{}
+	c, err := mdns.NewClient("kitchen.local.", mdns.RecordTypeA)
+	if err != nil {
+		t.Fatalf("NewClient returned %+v", err)
+	}
+	c.SetTransport(vn)
+	c.SetTimeout(time.Second)
+	dropped := make(chan *mdns.PacketError, 4)
+	c.SetErrorHandler(func(pe *mdns.PacketError) { dropped <- pe })
+	ch, err := c.Run()
+	if err != nil {
+		t.Fatalf("Client.Run returned %+v", err)
+	}
+
+	// a response claiming an answer it doesn't hold
+	liar, err := vn.Listen(nil, mdns.DefaultSocketOptions())
+	if err != nil {
+		t.Fatalf("VirtualNetwork.Listen returned %+v", err)
+	}
+	defer liar.Close()
+	_, err = liar.WriteTo([]byte{0x00, 0x00, 0x84, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00}, &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353})
+	if err != nil {
+		t.Fatalf("PacketConn.WriteTo returned %+v", err)
+	}
+
+	for r := range ch {
+		t.Errorf("Client delivered %+v from a malformed packet", r)
+	}
+	// the Client hears its own query, which is dropped too
+	for len(dropped) > 0 {
+		if pe := <-dropped; errors.Is(pe, io.ErrUnexpectedEOF) {
+			return
+		}
+	}
+	t.Errorf("the malformed packet was not reported to the error handler")
+}
@@ -0,0 +1,447 @@
+package mdns
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// The text format of records is the zone file format of RFC 1035 sec 5.1, as
+// dig prints it: one record per line, as name, TTL, class, type and data.
+// Classes other than IN (including IN with the cache-flush bit set) and types
+// this package doesn't know are written as RFC 3597 describes, as are the
+// data of records that were not decoded.
+
+// WriteZone writes recs to w in zone file format, one per line.
+func WriteZone(w io.Writer, recs []Record) error {
+	bw := bufio.NewWriter(w)
+	for i := range recs {
+		bw.WriteString(recs[i].String())
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+// ParseZone reads records in zone file format from r, such as WriteZone or
+// dig writes. Blank lines and comments (from a ';' to the end of the line)
+// are skipped. Every record must give its name, TTL, class and type.
+func ParseZone(r io.Reader) ([]Record, error) {
+	var recs []Record
+	sc := bufio.NewScanner(r)
+	line := 0
+	for sc.Scan() {
+		line++
+		f, err := zoneFields(sc.Text())
+		if err != nil {
+			return recs, fmt.Errorf("line %d: %w", line, err)
+		}
+		if len(f) == 0 {
+			continue
+		}
+		var rec Record
+		err = rec.parseZone(f)
+		if err != nil {
+			return recs, fmt.Errorf("line %d: %w", line, err)
+		}
+		recs = append(recs, rec)
+	}
+	return recs, sc.Err()
+}
+
+// String renders the record as a line of a zone file, without the newline.
+func (d *Record) String() string {
+	return fmt.Sprintf("%s\t%d\t%s\t%s\t%s", presentName(d.Subject), d.TTL, classString(d.Class), d.Type.zoneString(), zoneData(d.Value))
+}
+
+// zoneField is a field of a zone file line. Quoted fields are kept apart
+// since they may hold spaces, and only TXT data may use them.
+type zoneField struct {
+	s      string
+	quoted bool
+}
+
+// zoneFields splits a zone file line into fields, removing any comment.
+// Escapes are left in place, except within quotes.
+func zoneFields(line string) ([]zoneField, error) {
+	var f []zoneField
+	for i := 0; i < len(line); {
+		switch c := line[i]; {
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case c == ';':
+			return f, nil
+		case c == '"':
+			var b strings.Builder
+			i++
+			for {
+				if i >= len(line) {
+					return nil, ZoneSyntax
+				}
+				if line[i] == '"' {
+					i++
+					break
+				}
+				c, n, err := unescape(line[i:])
+				if err != nil {
+					return nil, err
+				}
+				b.WriteByte(c)
+				i += n
+			}
+			f = append(f, zoneField{s: b.String(), quoted: true})
+		default:
+			j := i
+			for j < len(line) && !strings.ContainsRune(" \t\r;\"", rune(line[j])) {
+				if line[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j > len(line) {
+				return nil, ZoneSyntax
+			}
+			f = append(f, zoneField{s: line[i:j]})
+			i = j
+		}
+	}
+	return f, nil
+}
+
+// unescape decodes the character at the start of s, which may be escaped as
+// \X or \DDD, returning it and how many bytes of s it took.
+func unescape(s string) (byte, int, error) {
+	if s[0] != '\\' {
+		return s[0], 1, nil
+	}
+	if len(s) < 2 {
+		return 0, 0, ZoneSyntax
+	}
+	if s[1] < '0' || s[1] > '9' {
+		return s[1], 2, nil
+	}
+	if len(s) < 4 {
+		return 0, 0, ZoneSyntax
+	}
+	n, err := strconv.ParseUint(s[1:4], 10, 8)
+	if err != nil {
+		return 0, 0, ZoneSyntax
+	}
+	return byte(n), 4, nil
+}
+
+func (d *Record) parseZone(f []zoneField) error {
+	if len(f) < 4 {
+		return ZoneSyntax
+	}
+	for _, x := range f[:4] {
+		if x.quoted {
+			return ZoneSyntax
+		}
+	}
+	d.Subject = &Subject{}
+	err := d.Subject.fromPresentation(f[0].s)
+	if err != nil {
+		return err
+	}
+	ttl, err := strconv.ParseUint(f[1].s, 10, 32)
+	if err != nil {
+		return ZoneSyntax
+	}
+	d.TTL = uint32(ttl)
+	d.Class, err = parseClass(f[2].s)
+	if err != nil {
+		return err
+	}
+	d.Type, err = ParseRecordType(f[3].s)
+	if err != nil {
+		return err
+	}
+	f = f[4:]
+
+	if len(f) > 0 && f[0].s == `\#` && !f[0].quoted {
+		und := &RecordUndecoded{}
+		err = und.parseGeneric(f[1:])
+		d.Value = und
+		return err
+	}
+	d.Value = d.Type.parser()
+	switch v := d.Value.(type) {
+	case *RecordA:
+		v.Addr, err = parseAddr(f, true)
+	case *RecordAAAA:
+		v.Addr, err = parseAddr(f, false)
+	case *RecordPTR:
+		err = parseNameField(f, &v.Name)
+	case *RecordCNAME:
+		err = parseNameField(f, &v.CanonicalName)
+	case *RecordSRV:
+		if len(f) != 4 {
+			return ZoneSyntax
+		}
+		var n [3]uint64
+		for i := range n {
+			n[i], err = strconv.ParseUint(f[i].s, 10, 16)
+			if err != nil {
+				return ZoneSyntax
+			}
+		}
+		v.Priority, v.Weight, v.Port = uint16(n[0]), uint16(n[1]), uint16(n[2])
+		err = parseNameField(f[3:], &v.Target)
+	case *RecordTXT:
+		txt := make([]string, len(f))
+		for i := range f {
+			if !f[i].quoted {
+				var b strings.Builder
+				for s := f[i].s; len(s) > 0; {
+					c, n, err := unescape(s)
+					if err != nil {
+						return err
+					}
+					b.WriteByte(c)
+					s = s[n:]
+				}
+				f[i].s = b.String()
+			}
+			if len(f[i].s) > 255 {
+				return TextStringTooLong
+			}
+			txt[i] = f[i].s
+		}
+		v.Text = encodeTXT(txt)
+	default:
+		// only the generic form can give data for an unknown type
+		return ZoneSyntax
+	}
+	return err
+}
+
+// parseGeneric reads data in the form of RFC 3597 sec 5: its length, then
+// the bytes in hex, which may be split into several fields.
+func (und *RecordUndecoded) parseGeneric(f []zoneField) error {
+	if len(f) < 1 {
+		return ZoneSyntax
+	}
+	l, err := strconv.ParseUint(f[0].s, 10, 16)
+	if err != nil {
+		return ZoneSyntax
+	}
+	var h strings.Builder
+	for _, x := range f[1:] {
+		h.WriteString(x.s)
+	}
+	und.buf, err = hex.DecodeString(h.String())
+	if err != nil || len(und.buf) != int(l) {
+		return ZoneSyntax
+	}
+	return nil
+}
+
+func parseAddr(f []zoneField, v4 bool) (net.IP, error) {
+	if len(f) != 1 {
+		return nil, ZoneSyntax
+	}
+	ip := net.ParseIP(f[0].s)
+	if ip == nil || (ip.To4() != nil) != v4 {
+		return nil, ZoneSyntax
+	}
+	return ip, nil
+}
+
+func parseNameField(f []zoneField, s *Subject) error {
+	if len(f) != 1 || f[0].quoted {
+		return ZoneSyntax
+	}
+	return s.fromPresentation(f[0].s)
+}
+
+// zoneData renders a record's data for a zone file.
+func zoneData(v ParseableRecord) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case *RecordA:
+		return v.Addr.String()
+	case *RecordAAAA:
+		return v.Addr.String()
+	case *RecordPTR:
+		return presentName(&v.Name)
+	case *RecordCNAME:
+		return presentName(&v.CanonicalName)
+	case *RecordSRV:
+		return fmt.Sprintf("%d %d %d %s", v.Priority, v.Weight, v.Port, presentName(&v.Target))
+	case *RecordTXT:
+		var b strings.Builder
+		for i, t := range v.Strings() {
+			if i > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteByte('"')
+			for j := 0; j < len(t); j++ {
+				switch c := t[j]; {
+				case c == '"' || c == '\\':
+					b.WriteByte('\\')
+					b.WriteByte(c)
+				case c < 0x20 || c > 0x7e:
+					fmt.Fprintf(&b, "\\%03d", c)
+				default:
+					b.WriteByte(c)
+				}
+			}
+			b.WriteByte('"')
+		}
+		return b.String()
+	}
+	raw := v.encode()
+	if len(raw) == 0 {
+		return `\# 0`
+	}
+	return fmt.Sprintf(`\# %d %x`, len(raw), raw)
+}
+
+// presentName renders s as a zone file does: dotted, with the characters
+// that would otherwise be misread within a label escaped.
+func presentName(s *Subject) string {
+	if s == nil || len(s.s) == 0 {
+		return ""
+	}
+	if s.s[0] == 0 {
+		return "."
+	}
+	var b strings.Builder
+	for p := 0; p < len(s.s) && s.s[p] != 0; {
+		l := int(s.s[p])
+		p++
+		for _, c := range s.s[p : p+l] {
+			switch {
+			case strings.IndexByte(`."\;()@$`, c) >= 0:
+				b.WriteByte('\\')
+				b.WriteByte(c)
+			case c <= 0x20 || c > 0x7e:
+				fmt.Fprintf(&b, "\\%03d", c)
+			default:
+				b.WriteByte(c)
+			}
+		}
+		b.WriteByte('.')
+		p += l
+	}
+	return b.String()
+}
+
+// fromPresentation builds the Subject from a name as presentName writes it.
+// Unlike FromString, escaped dots don't end a label. The name is taken to be
+// absolute whether or not it ends with a dot.
+func (s *Subject) fromPresentation(str string) error {
+	s.s = nil
+	if str == "." {
+		s.s = []byte{0}
+		return nil
+	}
+	if str == "" {
+		return IllegalHostnameLabelEmpty
+	}
+	var b []byte
+	label := []byte{0}
+	end := func() error {
+		if len(label) == 1 {
+			return IllegalHostnameLabelEmpty
+		}
+		if len(label) > 64 {
+			return IllegalHostnameLabelTooLong
+		}
+		label[0] = byte(len(label) - 1)
+		b = append(b, label...)
+		label = label[:1]
+		return nil
+	}
+	for i := 0; i < len(str); {
+		if str[i] == '.' {
+			if err := end(); err != nil {
+				return err
+			}
+			i++
+			continue
+		}
+		c, n, err := unescape(str[i:])
+		if err != nil {
+			return err
+		}
+		label = append(label, c)
+		i += n
+	}
+	if len(label) > 1 {
+		if err := end(); err != nil {
+			return err
+		}
+	}
+	b = append(b, 0)
+	if len(b) > maxNameLength {
+		return IllegalHostnameTooLong
+	}
+	s.s = b
+	return nil
+}
+
+// classString renders a class as a zone file does.
+func classString(c uint16) string {
+	if c == 1 {
+		return "IN"
+	}
+	return fmt.Sprintf("CLASS%d", c)
+}
+
+func parseClass(s string) (uint16, error) {
+	if strings.EqualFold(s, "IN") {
+		return 1, nil
+	}
+	if len(s) > 5 && strings.EqualFold(s[:5], "CLASS") {
+		n, err := strconv.ParseUint(s[5:], 10, 16)
+		if err == nil {
+			return uint16(n), nil
+		}
+	}
+	return 0, ZoneSyntax
+}
+
+// zoneString is like String, but writes names as zone files do: ANY in
+// capitals, and unknown types as RFC 3597 does.
+func (t RecordType) zoneString() string {
+	if t == RecordTypeAny {
+		return "ANY"
+	}
+	if t.known() {
+		return t.String()
+	}
+	return fmt.Sprintf("TYPE%d", uint16(t))
+}
+
+// known reports whether t is a type this package has a name for.
+func (t RecordType) known() bool {
+	switch t {
+	case RecordTypeA, RecordTypeCNAME, RecordTypePTR, RecordTypeTXT, RecordTypeAAAA, RecordTypeSRV, RecordTypeAny:
+		return true
+	}
+	return false
+}
+
+// ParseRecordType returns the RecordType named by s, such as "AAAA" or, for
+// types without a name here, "TYPE65".
+func ParseRecordType(s string) (RecordType, error) {
+	u := strings.ToUpper(s)
+	if strings.HasPrefix(u, "TYPE") {
+		n, err := strconv.ParseUint(u[4:], 10, 16)
+		if err == nil {
+			return RecordType(n), nil
+		}
+	}
+	for _, t := range []RecordType{RecordTypeA, RecordTypeCNAME, RecordTypePTR, RecordTypeTXT, RecordTypeAAAA, RecordTypeSRV, RecordTypeAny} {
+		if strings.ToUpper(t.String()) == u {
+			return t, nil
+		}
+	}
+	return 0, RecordTypeUnknown
+}
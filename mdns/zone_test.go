@@ -0,0 +1,154 @@
+package mdns_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/ironiridis/klonderoo/mdns"
+)
+
+const zoneSample = `; <<>> DiG <<>> -p 5353 @224.0.0.251 _googlecast._tcp.local. PTR
+;; ANSWER SECTION:
+_googlecast._tcp.local.	4500	IN	PTR	Living\032Room\.tv._googlecast._tcp.local.
+
+;; ADDITIONAL SECTION:
+Living\032Room\.tv._googlecast._tcp.local.	4500	CLASS32769	TXT	"id=0123" "fn=Living Room" "say \"hi\"\\" "\255"
+Living\032Room\.tv._googlecast._tcp.local.	120	CLASS32769	SRV	0 0 8009 cast-0123.local.
+cast-0123.local.	120	CLASS32769	A	192.168.1.50
+cast-0123.local.	120	CLASS32769	AAAA	fe80::1
+www.local.	10	IN	CNAME	cast-0123.local.
+cast-0123.local.	120	CLASS32769	TYPE47	\# 6 c0 0c 00 02 00 08
+cast-0123.local.	120	IN	A	\# 3 0a0000
+`
+
+func TestZoneRoundTrip(t *testing.T) {
+	recs, err := mdns.ParseZone(strings.NewReader(zoneSample))
+	if err != nil {
+		t.Fatalf("ParseZone returned %+v", err)
+	}
+	if len(recs) != 8 {
+		t.Fatalf("ParseZone returned %d records, not 8", len(recs))
+	}
+	if txt := recs[1].Value.(*mdns.RecordTXT).Strings(); len(txt) != 4 || txt[1] != "fn=Living Room" || txt[2] != `say "hi"\` || txt[3] != "\xff" {
+		t.Errorf("the TXT record was parsed as %q", txt)
+	}
+	if name := recs[0].Value.(*mdns.RecordPTR).Name.Encode(); name[0] != 14 || string(name[1:15]) != "Living Room.tv" {
+		t.Errorf("the escaped PTR target was parsed as %q", name)
+	}
+
+	var buf bytes.Buffer
+	err = mdns.WriteZone(&buf, recs)
+	if err != nil {
+		t.Fatalf("WriteZone returned %+v", err)
+	}
+	again, err := mdns.ParseZone(&buf)
+	if err != nil {
+		t.Fatalf("ParseZone of WriteZone's output returned %+v", err)
+	}
+	for i := range recs {
+		if recs[i].String() != again[i].String() {
+			t.Errorf("record %d was written and read back as %q, not %q", i, again[i].String(), recs[i].String())
+		}
+	}
+
+	js, err := json.Marshal(recs)
+	if err != nil {
+		t.Fatalf("json.Marshal returned %+v", err)
+	}
+	var fromJSON []mdns.Record
+	err = json.Unmarshal(js, &fromJSON)
+	if err != nil {
+		t.Fatalf("json.Unmarshal returned %+v", err)
+	}
+	for i := range recs {
+		if recs[i].String() != fromJSON[i].String() {
+			t.Errorf("record %d went through JSON as %q, not %q", i, fromJSON[i].String(), recs[i].String())
+		}
+	}
+	if !strings.Contains(string(js), `"raw":"CgAA"`) {
+		t.Errorf("undecoded data was not given in base64: %s", js)
+	}
+}
+
+func TestZoneMalformed(t *testing.T) {
+	for _, line := range []string{
+		"a.local. 120 IN A",
+		"a.local. 120 IN A 2001:db8::1",
+		"a.local. soon IN A 10.0.0.1",
+		"a.local. 120 CH A 10.0.0.1",
+		"a.local. 120 IN MX 10 b.local.",
+		`a.local. 120 IN TXT "unterminated`,
+		`a.local. 120 IN TYPE99 \# 2 00`,
+	} {
+		_, err := mdns.ParseZone(strings.NewReader(line))
+		if err == nil {
+			t.Errorf("ParseZone(%q) succeeded", line)
+		}
+	}
+}
+
+func TestRecordJSONMalformed(t *testing.T) {
+	for _, js := range []string{
+		`{"name": "a.local.", "type": "A", "class": 1, "ttl": 120, "data": 5}`,
+		`{"name": "a.local.", "type": "A", "class": 1, "ttl": 120, "data": ["10.0.0.1"]}`,
+		`{"name": "a.local.", "type": "A", "class": 1, "ttl": 120, "data": {"raw": 5}}`,
+		`{"name": "a.local.", "type": "MX", "class": 1, "ttl": 120, "data": null}`,
+	} {
+		var r mdns.Record
+		if err := json.Unmarshal([]byte(js), &r); err == nil {
+			t.Errorf("json.Unmarshal(%s) succeeded, giving %s", js, r.String())
+		}
+	}
+}
+
+func TestRecordJSONValue(t *testing.T) {
+	recs, err := mdns.ParseZone(strings.NewReader("a.local. 120 IN A 10.0.0.1"))
+	if err != nil {
+		t.Fatalf("ParseZone returned %+v", err)
+	}
+	js, err := json.Marshal(recs[0])
+	if err != nil {
+		t.Fatalf("json.Marshal returned %+v", err)
+	}
+	var r mdns.Record
+	if err = json.Unmarshal(js, &r); err != nil {
+		t.Fatalf("json.Unmarshal(%s) returned %+v", js, err)
+	}
+	if r.String() != recs[0].String() {
+		t.Errorf("a Record value went through JSON as %q, not %q", r.String(), recs[0].String())
+	}
+
+	js, err = json.Marshal(map[string]mdns.Record{"a": recs[0]})
+	if err != nil {
+		t.Fatalf("json.Marshal returned %+v", err)
+	}
+	var m map[string]mdns.Record
+	if err = json.Unmarshal(js, &m); err != nil {
+		t.Fatalf("json.Unmarshal(%s) returned %+v", js, err)
+	}
+	if r = m["a"]; r.String() != recs[0].String() {
+		t.Errorf("a Record in a map went through JSON as %q, not %q", r.String(), recs[0].String())
+	}
+}
+
+func TestRecordTypeText(t *testing.T) {
+	for _, try := range []struct {
+		t    mdns.RecordType
+		text string
+	}{
+		{mdns.RecordTypeAAAA, "AAAA"},
+		{mdns.RecordTypeAny, "ANY"},
+		{mdns.RecordType(47), "TYPE47"},
+	} {
+		b, err := try.t.MarshalText()
+		if err != nil || string(b) != try.text {
+			t.Errorf("RecordType(%d).MarshalText returned %q, %+v, expected %q", try.t, b, err, try.text)
+		}
+		var back mdns.RecordType
+		if err = back.UnmarshalText(b); err != nil || back != try.t {
+			t.Errorf("RecordType.UnmarshalText(%q) gave %d, %+v", b, back, err)
+		}
+	}
+}